@@ -0,0 +1,17 @@
+package main
+
+// AccountMovement represents a movement of the user account
+type AccountMovement struct {
+	ID     int
+	From   string
+	To     string
+	Amount float64
+}
+
+// Debt represents a user's debt
+type Debt struct {
+	ID     int
+	UserID int
+	Reason string
+	Amount float64
+}
@@ -1,8 +1,31 @@
 package main
 
-import "log"
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/jegutierrez/functional_patterns_go/filter"
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+	"github.com/jegutierrez/functional_patterns_go/logging"
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
 
 func main() {
+	addr := flag.String("addr", "", "serve the handlers on addr after the demo, e.g. :8081")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP traces URL spans are exported to, e.g. http://localhost:4318/v1/traces")
+	logFormat := flag.String("log-format", "text", "format of the log lines, text or json")
+	logLevel := flag.String("log-level", "info", "lowest level logged, e.g. debug or warn")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		fatal("creating logger", err)
+	}
+	slog.SetDefault(logger)
+
 	movements := []AccountMovement{
 		{ID: 1, From: "a", To: "b", Amount: 7},
 		{ID: 2, From: "c", To: "b", Amount: 14},
@@ -12,12 +35,12 @@ func main() {
 		{ID: 6, From: "e", To: "i", Amount: 45},
 	}
 	var tinyMovements []AccountMovement
-	MinFilter(len(movements), 10, func(i int) float64 {
+	filter.MinFilter(len(movements), 10, func(i int) float64 {
 		return movements[i].Amount
 	}, func(i int) {
 		tinyMovements = append(tinyMovements, movements[i])
 	})
-	log.Printf("%+v\n", tinyMovements)
+	slog.Info("tiny movements", "movements", tinyMovements)
 
 	debts := []Debt{
 		{ID: 1, Reason: "x", UserID: 4, Amount: 16},
@@ -30,26 +53,56 @@ func main() {
 		{ID: 8, Reason: "x", UserID: 2, Amount: 26},
 	}
 	var tinyDebts []Debt
-	MinFilter(len(debts), 10, func(i int) float64 {
+	filter.MinFilter(len(debts), 10, func(i int) float64 {
 		return debts[i].Amount
 	}, func(i int) {
 		tinyDebts = append(tinyDebts, debts[i])
 	})
-	log.Printf("%+v\n", tinyDebts)
+	slog.Info("tiny debts", "debts", tinyDebts)
 
 	var bigMovements []AccountMovement
-	Filter(len(movements), func(i int) bool {
+	filter.Filter(len(movements), func(i int) bool {
 		return movements[i].Amount > 20
 	}, func(i int) {
 		bigMovements = append(bigMovements, movements[i])
 	})
 
 	var bigDebts []Debt
-	Filter(len(debts), func(i int) bool {
+	filter.Filter(len(debts), func(i int) bool {
 		return debts[i].Amount > 20
 	}, func(i int) {
 		bigDebts = append(bigDebts, debts[i])
 	})
 
-	log.Printf("%+v\n", bigMovements)
+	slog.Info("big movements", "movements", bigMovements)
+
+	if *addr != "" {
+		serve(*addr, *otlpEndpoint, MySQL{})
+	}
+}
+
+// serve runs the handlers until SIGINT or SIGTERM, then drains them and
+// closes the repository and the tracer. Spans are only exported when
+// otlpEndpoint is set.
+func serve(addr, otlpEndpoint string, repository MySQL) {
+	lc := lifecycle.New()
+	lc.OnClose("mysql", func(context.Context) error {
+		return repository.Close()
+	})
+	tracer := tracing.Noop()
+	if otlpEndpoint != "" {
+		provider := tracing.New("closures", tracing.NewOTLPExporter(otlpEndpoint))
+		lc.OnClose("tracer", provider.Shutdown)
+		tracer = provider
+	}
+	lc.AddServer(&http.Server{Addr: addr, Handler: routes(repository, lc, tracer)}, "", "")
+	if err := lc.Run(context.Background()); err != nil {
+		fatal("serving", err)
+	}
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
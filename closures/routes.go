@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+	"github.com/jegutierrez/functional_patterns_go/middleware"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+	"github.com/jegutierrez/functional_patterns_go/router"
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+// routes serves the closures handlers behind the standard middleware,
+// traced with tracer, and the probes of lc on /healthz and /readyz.
+func routes(repository DB, lc *lifecycle.Manager, tracer tracing.Tracer) http.Handler {
+	standard := middleware.Chain(
+		middleware.RequestID(),
+		middleware.Logger(slog.Default()),
+		middleware.AccessLog(),
+		middleware.Recover(),
+		middleware.Timeout(2*time.Second),
+		middleware.Gzip(),
+	)
+	limitBody := middleware.MaxBodyBytes(64 << 10)
+
+	rt := router.New()
+	balanceUserID := func(r *http.Request) string { return r.PathValue("id") }
+	rt.Handle(http.MethodPost, "/users", standard(middleware.LogRoute("users", nil)(middleware.Trace(tracer, "users")(limitBody(problem.Handle(saveUserHandler(repository)))))))
+	rt.Handle(http.MethodGet, "/balance/{id:int}", standard(middleware.LogRoute("balance", balanceUserID)(middleware.Trace(tracer, "balance")(problem.Handle(balanceHandler(100, tracer))))))
+	rt.Handle(http.MethodGet, "/healthz", lc.LivenessHandler())
+	rt.Handle(http.MethodGet, "/readyz", lc.ReadinessHandler())
+	return rt
+}
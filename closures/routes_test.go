@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+	"github.com/jegutierrez/functional_patterns_go/middleware"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+func TestRoutesMiddleware(t *testing.T) {
+	mockDB := MockDB{MockSaveUserFn: helperMockDB(t)}
+	srv := httptest.NewServer(routes(mockDB, lifecycle.New(), tracing.Noop()))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/users", "application/json", strings.NewReader(`{"name": "john"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if status := res.StatusCode; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if res.Header.Get(middleware.RequestIDHeader) == "" {
+		t.Errorf("response has no request ID")
+	}
+
+	large := strings.NewReader(`{"name": "` + strings.Repeat("j", 128<<10) + `"}`)
+	res, err = http.Post(srv.URL+"/users", "application/json", large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if status := res.StatusCode; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestRoutesTracing(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	srv := httptest.NewServer(routes(MockDB{MockSaveUserFn: helperMockDB(t)}, lifecycle.New(), tracing.New("closures", exporter)))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/balance/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("unspected spans, want: 2, got: %d", len(spans))
+	}
+	balances, server := spans[0], spans[1]
+	if balances.Name != "balances" || balances.Parent != server.SpanContext.SpanID || balances.Attribute("user_id") != 2 {
+		t.Errorf("unspected balances span, want child of %q, got: %+v", server.Name, balances)
+	}
+}
+
+func TestBalanceRejectsInvalidID(t *testing.T) {
+	srv := httptest.NewServer(routes(MockDB{MockSaveUserFn: helperMockDB(t)}, lifecycle.New(), tracing.Noop()))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/balance/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest || res.Header.Get("Content-Type") != problem.ContentType {
+		t.Errorf("unspected response, want: 400 %s, got: %d %s", problem.ContentType, res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var details problem.Details
+	if err := json.NewDecoder(res.Body).Decode(&details); err != nil {
+		t.Fatal(err)
+	}
+	want := problem.Details{Type: "about:blank", Title: "Bad Request", Status: 400, Detail: `id "abc" is not an int`, Instance: "/balance/abc"}
+	if details != want {
+		t.Errorf("unspected result, want: %+v, got: %+v", want, details)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
 )
 
 // DB represents a Database interface.
@@ -19,32 +21,36 @@ func (m MySQL) SaveUser(u User) {
 	// DB save
 }
 
+// Close is a fake function to close the connections to the DB.
+func (m MySQL) Close() error {
+	return nil
+}
+
 // User data.
 type User struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
 }
 
-func saveUserHandler(repository DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func saveUserHandler(repository DB) problem.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 
 		b, err := ioutil.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
-			http.Error(w, err.Error(), 500)
-			return
+			return err
 		}
 
 		var msg User
 		err = json.Unmarshal(b, &msg)
 		if err != nil {
-			http.Error(w, err.Error(), 500)
-			return
+			return problem.BadRequest("invalid user: %w", err)
 		}
 
 		repository.SaveUser(msg)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(msg)
+		return nil
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
 )
 
 type MockDB struct {
@@ -41,7 +43,7 @@ func TestHttpHandler(t *testing.T) {
 
 	saveUser := saveUserHandler(mockDB)
 
-	handler := http.HandlerFunc(saveUser)
+	handler := problem.Handle(saveUser)
 	handler.ServeHTTP(res, req)
 
 	if status := res.Code; status != http.StatusOK {
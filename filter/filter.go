@@ -1,20 +1,6 @@
-package main
-
-// AccountMovement represents a movement of the user account
-type AccountMovement struct {
-	ID     int
-	From   string
-	To     string
-	Amount float64
-}
-
-// Debt represents a user's debt
-type Debt struct {
-	ID     int
-	UserID int
-	Reason string
-	Amount float64
-}
+// Package filter filters slices of any type through closures: the caller
+// reads and appends the elements by index, so no generic types are needed.
+package filter
 
 // MinFilter generic function to filter a slice on min Amount.
 // Params:
@@ -33,7 +19,7 @@ func MinFilter(l int, min float64, amountGetter func(int) float64, appender func
 // Filter generic function to filter a slice on a given predicate.
 // Params:
 // l 			-> slice length
-// amountGetter -> closure to get the Amount value
+// predicate 	-> closure telling if the element at an index is kept
 // appender 	-> closure to append to the original slice
 func Filter(l int, predicate func(int) bool, appender func(int)) {
 	for i := 0; i < l; i++ {
@@ -42,3 +28,16 @@ func Filter(l int, predicate func(int) bool, appender func(int)) {
 		}
 	}
 }
+
+// And combines predicates into one that holds when all of them hold. With
+// no predicates it always holds.
+func And(predicates ...func(int) bool) func(int) bool {
+	return func(i int) bool {
+		for _, predicate := range predicates {
+			if !predicate(i) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,50 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	amounts := []float64{7, 14, 22, 56, 8, 45}
+	over := func(min float64) func(int) bool {
+		return func(i int) bool { return amounts[i] > min }
+	}
+	under := func(max float64) func(int) bool {
+		return func(i int) bool { return amounts[i] < max }
+	}
+	tests := []struct {
+		name      string
+		predicate func(int) bool
+		want      []float64
+	}{
+		{"predicate", over(20), []float64{22, 56, 45}},
+		{"and", And(over(10), under(50)), []float64{14, 22, 45}},
+		{"empty and", And(), amounts},
+		{"no match", And(over(50), under(20)), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []float64
+			Filter(len(amounts), tt.predicate, func(i int) {
+				got = append(got, amounts[i])
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unspected result, want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMinFilter(t *testing.T) {
+	amounts := []float64{16, 4, 12, 36, 18, 5}
+	var got []float64
+	MinFilter(len(amounts), 10, func(i int) float64 {
+		return amounts[i]
+	}, func(i int) {
+		got = append(got, amounts[i])
+	})
+	if want := []float64{4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unspected result, want: %v, got: %v", want, got)
+	}
+}
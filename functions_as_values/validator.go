@@ -1,6 +1,6 @@
 package main
 
-import "log"
+import "log/slog"
 
 // Movement represent an account movement.
 type Movement struct {
@@ -41,12 +41,12 @@ func main() {
 	}
 
 	if !MovementValidator[validIncome.MovementType](validIncome) {
-		log.Printf("Invalid movement %d", validIncome.ID)
+		slog.Warn("invalid movement", "id", validIncome.ID)
 	}
 	if !MovementValidator[validExpense.MovementType](validExpense) {
-		log.Printf("Invalid movement %d", validExpense.ID)
+		slog.Warn("invalid movement", "id", validExpense.ID)
 	}
 	if !MovementValidator[invalidIncomeMov.MovementType](invalidIncomeMov) {
-		log.Printf("Invalid movement %d", invalidIncomeMov.ID)
+		slog.Warn("invalid movement", "id", invalidIncomeMov.ID)
 	}
 }
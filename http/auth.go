@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// Scopes checked by the routes of the server.
+const (
+	scopeUsersRead   = "users:read"
+	scopeBalanceRead = "balance:read"
+	scopeDebtsRead   = "debts:read"
+)
+
+var (
+	errNoCredentials     = errors.New("no credentials")
+	errInvalidToken      = errors.New("invalid token")
+	errExpiredToken      = errors.New("expired token")
+	errUnknownAPIKey     = errors.New("unknown api key")
+	errMissingSecret     = errors.New("no hmac secret configured")
+	errInvalidKeyFile    = errors.New("invalid key file")
+	errInsufficientScope = errors.New("insufficient scope")
+)
+
+// KeyFile holds the credentials accepted by the server.
+type KeyFile struct {
+	// HMACSecret signs and verifies bearer tokens (HS256 JWT).
+	HMACSecret string   `json:"hmac_secret"`
+	APIKeys    []APIKey `json:"api_keys"`
+}
+
+// APIKey is a static credential sent in the X-API-Key header.
+type APIKey struct {
+	Key     string   `json:"key"`
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+// LoadKeyFile reads a JSON key file.
+func LoadKeyFile(path string) (KeyFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return KeyFile{}, err
+	}
+	defer f.Close()
+
+	var keys KeyFile
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&keys); err != nil {
+		return KeyFile{}, fmt.Errorf("%w %s: %v", errInvalidKeyFile, path, err)
+	}
+	return keys, nil
+}
+
+// The demo credentials are accepted by demoConfig, so handler() and tests
+// work out of the box. Validate rejects them: real deployments load their
+// own keys with -auth-keys.
+const (
+	demoAPIKey     = "demo-api-key"
+	demoHMACSecret = "demo-hmac-secret"
+)
+
+func demoKeys() KeyFile {
+	return KeyFile{
+		HMACSecret: demoHMACSecret,
+		APIKeys: []APIKey{{
+			Key:     demoAPIKey,
+			Subject: "demo",
+			Scopes:  []string{scopeUsersRead, scopeBalanceRead, scopeDebtsRead},
+			Roles:   []string{roleAdmin},
+		}},
+	}
+}
+
+// Principal is the authenticated caller of a request. For end users the
+// Subject is their user ID.
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Roles   []string
+}
+
+// HasScope reports whether p was granted scope.
+func (p Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// HasRole reports whether p has role.
+func (p Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// withPrincipal returns a copy of ctx carrying p.
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal authenticated for ctx, if any.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator verifies bearer tokens and API keys.
+type Authenticator struct {
+	secret  []byte
+	apiKeys []APIKey
+	now     func() time.Time
+}
+
+// NewAuthenticator accepts the credentials listed in keys.
+func NewAuthenticator(keys KeyFile) *Authenticator {
+	return &Authenticator{
+		secret:  []byte(keys.HMACSecret),
+		apiKeys: keys.APIKeys,
+		now:     time.Now,
+	}
+}
+
+// Authenticate finds the principal of r from its Authorization bearer token
+// or its X-API-Key header.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.verifyToken(strings.TrimSpace(token))
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.verifyAPIKey(key)
+	}
+	return Principal{}, errNoCredentials
+}
+
+func (a *Authenticator) verifyAPIKey(key string) (Principal, error) {
+	var found *APIKey
+	for i := range a.apiKeys {
+		// compare every key in constant time so timing doesn't leak them.
+		if subtle.ConstantTimeCompare([]byte(a.apiKeys[i].Key), []byte(key)) == 1 {
+			found = &a.apiKeys[i]
+		}
+	}
+	if found == nil {
+		return Principal{}, errUnknownAPIKey
+	}
+	return Principal{Subject: found.Subject, Scopes: found.Scopes, Roles: found.Roles}, nil
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type tokenClaims struct {
+	Subject   string   `json:"sub"`
+	Scope     string   `json:"scope"`
+	Roles     []string `json:"roles,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// IssueToken signs a bearer token for subject valid for ttl.
+func (a *Authenticator) IssueToken(subject string, scopes []string, ttl time.Duration, roles ...string) (string, error) {
+	if len(a.secret) == 0 {
+		return "", errMissingSecret
+	}
+	now := a.now()
+	claims, err := json.Marshal(tokenClaims{
+		Subject:   subject,
+		Scope:     strings.Join(scopes, " "),
+		Roles:     roles,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + a.sign(unsigned), nil
+}
+
+func (a *Authenticator) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *Authenticator) verifyToken(token string) (Principal, error) {
+	if len(a.secret) == 0 {
+		return Principal{}, errMissingSecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Principal{}, errInvalidToken
+	}
+	if !hmac.Equal([]byte(a.sign(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return Principal{}, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Principal{}, errInvalidToken
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Principal{}, errInvalidToken
+	}
+	if a.now().Unix() >= claims.ExpiresAt {
+		return Principal{}, errExpiredToken
+	}
+	return Principal{Subject: claims.Subject, Scopes: strings.Fields(claims.Scope), Roles: claims.Roles}, nil
+}
+
+// onlyAuthenticated answers 401 to requests without valid credentials and
+// passes the principal of the others to h in the request context.
+func onlyAuthenticated(auth *Authenticator, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := auth.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="user-status"`)
+			problem.Write(w, r, problem.Wrap(http.StatusUnauthorized, err))
+			return
+		}
+		h(w, r.WithContext(withPrincipal(r.Context(), principal)))
+	}
+}
+
+// requireScope answers 403 unless the authenticated principal was granted
+// scope. It must run after onlyAuthenticated.
+func requireScope(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFrom(r.Context())
+		if !ok || !principal.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+			problem.Write(w, r, problem.Forbidden("%w: %s required", errInsufficientScope, scope))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Credentials authenticates an outgoing request of the client.
+type Credentials func(req *http.Request)
+
+// APIKeyCredentials sends key in the X-API-Key header.
+func APIKeyCredentials(key string) Credentials {
+	return func(req *http.Request) {
+		req.Header.Set("X-API-Key", key)
+	}
+}
+
+// BearerCredentials sends token in the Authorization header.
+func BearerCredentials(token string) Credentials {
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// defaultCredentials uses the API_TOKEN or API_KEY env vars, falling back
+// to the demo key accepted by demoConfig.
+func defaultCredentials() Credentials {
+	if token := os.Getenv("API_TOKEN"); token != "" {
+		return BearerCredentials(token)
+	}
+	if key := os.Getenv("API_KEY"); key != "" {
+		return APIKeyCredentials(key)
+	}
+	return APIKeyCredentials(demoAPIKey)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthentication(t *testing.T) {
+	keys := KeyFile{
+		HMACSecret: "test-secret",
+		APIKeys: []APIKey{
+			{Key: "reader-key", Subject: "reader", Scopes: []string{scopeUsersRead, scopeBalanceRead}},
+		},
+	}
+	auth := NewAuthenticator(keys)
+	valid, _ := auth.IssueToken("2", []string{scopeBalanceRead}, time.Minute)
+	noScope, _ := auth.IssueToken("2", []string{scopeUsersRead}, time.Minute)
+	expired, _ := auth.IssueToken("2", []string{scopeBalanceRead}, -time.Minute)
+	forged, _ := NewAuthenticator(KeyFile{HMACSecret: "other-secret"}).IssueToken("2", []string{scopeBalanceRead}, time.Minute)
+
+	h := onlyAuthenticated(auth, requireScope(scopeBalanceRead, func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFrom(r.Context())
+		w.Write([]byte(principal.Subject))
+	}))
+
+	tt := []struct {
+		name        string
+		credentials Credentials
+		status      int
+		subject     string
+	}{
+		{name: "valid token", credentials: BearerCredentials(valid), status: http.StatusOK, subject: "2"},
+		{name: "valid api key", credentials: APIKeyCredentials("reader-key"), status: http.StatusOK, subject: "reader"},
+		{name: "no credentials", credentials: func(*http.Request) {}, status: http.StatusUnauthorized},
+		{name: "unknown api key", credentials: APIKeyCredentials("other-key"), status: http.StatusUnauthorized},
+		{name: "expired token", credentials: BearerCredentials(expired), status: http.StatusUnauthorized},
+		{name: "forged token", credentials: BearerCredentials(forged), status: http.StatusUnauthorized},
+		{name: "missing scope", credentials: BearerCredentials(noScope), status: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/balance/2", nil)
+			tc.credentials(req)
+			res := httptest.NewRecorder()
+
+			h(res, req)
+
+			if res.Code != tc.status {
+				t.Errorf("unspected status, want: %d, got: %d", tc.status, res.Code)
+			}
+			if tc.subject != "" && res.Body.String() != tc.subject {
+				t.Errorf("unspected principal, want: %s, got: %s", tc.subject, res.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// roleAdmin may read the data of any user.
+const roleAdmin = "admin"
+
+// policy decides whether principal may read the data of userID.
+type policy func(principal Principal, userID int) bool
+
+// anyPrincipal lets every authenticated principal in.
+func anyPrincipal(Principal, int) bool {
+	return true
+}
+
+// ownerOrAdmin lets users read only their own data, and admins read any.
+func ownerOrAdmin(principal Principal, userID int) bool {
+	return principal.HasRole(roleAdmin) || principal.Subject == strconv.Itoa(userID)
+}
+
+// routePolicies is the authorization table of the server, keyed by route.
+var routePolicies = map[string]policy{
+	"users":       anyPrincipal,
+	"balance":     ownerOrAdmin,
+	"user-debts":  ownerOrAdmin,
+	"user-status": ownerOrAdmin,
+}
+
+// requireRole answers 403 unless the authenticated principal has role. It
+// must run after onlyAuthenticated.
+func requireRole(role string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFrom(r.Context())
+		if !ok || !principal.HasRole(role) {
+			problem.Write(w, r, problem.Forbidden("role %s required", role))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// authorize answers 403 unless the authenticated principal may read every
+// user asked in the request, either the {id} path segment or the ids of a
+// batch query. It must run after onlyAuthenticated.
+func authorize(allowed policy, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFrom(r.Context())
+		if !ok {
+			problem.Write(w, r, problem.Forbidden("no authenticated principal"))
+			return
+		}
+		userIDs, err := requestedUserIDs(r)
+		if err != nil {
+			problem.Write(w, r, problem.Wrap(http.StatusBadRequest, err))
+			return
+		}
+		for _, userID := range userIDs {
+			if !allowed(principal, userID) {
+				problem.Write(w, r, problem.Forbidden("%s may not read user %d", principal.Subject, userID))
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// allow checks the principal of ctx may read the data of userID served by
+// route, as the middlewares of the route do.
+func allow(ctx context.Context, route, scope string, userID int) error {
+	principal, ok := PrincipalFrom(ctx)
+	if !ok || !principal.HasScope(scope) {
+		return fmt.Errorf("%w: %s required", errInsufficientScope, scope)
+	}
+	if !routePolicies[route](principal, userID) {
+		return fmt.Errorf("%s may not read user %d", principal.Subject, userID)
+	}
+	return nil
+}
+
+// requestedUserIDs returns the users a request reads: the {id} wildcard of
+// single user routes, or else the ids query param of batch routes. The ids
+// of a single user route are ignored, as its handler is.
+func requestedUserIDs(r *http.Request) ([]int, error) {
+	raw := []string{r.PathValue("id")}
+	if raw[0] == "" {
+		raw = strings.Split(r.URL.Query().Get("ids"), ",")
+	}
+	var ids []int
+	for _, s := range raw {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("user ID %q is not a number", s)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRoutePolicies(t *testing.T) {
+	owner := Principal{Subject: "2"}
+	admin := Principal{Subject: "ops", Roles: []string{roleAdmin}}
+
+	tt := []struct {
+		name      string
+		route     string
+		principal Principal
+		userID    int
+		allowed   bool
+	}{
+		{name: "owner reads own balance", route: "balance", principal: owner, userID: 2, allowed: true},
+		{name: "owner reads other balance", route: "balance", principal: owner, userID: 3, allowed: false},
+		{name: "owner reads other debts", route: "user-debts", principal: owner, userID: 3, allowed: false},
+		{name: "admin reads other debts", route: "user-debts", principal: admin, userID: 3, allowed: true},
+		{name: "owner reads other user", route: "users", principal: owner, userID: 3, allowed: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			result := routePolicies[tc.route](tc.principal, tc.userID)
+
+			if result != tc.allowed {
+				t.Errorf("unspected result, want: %t, got: %t", tc.allowed, result)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequests(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+	token, err := NewAuthenticator(demoKeys()).IssueToken("2", []string{scopeUsersRead, scopeBalanceRead, scopeDebtsRead}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		path   string
+		status int
+	}{
+		{path: "/balance/2", status: http.StatusOK},
+		{path: "/balance/3", status: http.StatusForbidden},
+		{path: "/user-debts/3", status: http.StatusForbidden},
+		{path: "/balance?ids=2,3", status: http.StatusForbidden},
+		{path: "/balance/abc", status: http.StatusBadRequest},
+		{path: "/balance/3?ids=2", status: http.StatusForbidden},
+		{path: "/user-debts/3?ids=2", status: http.StatusForbidden},
+		{path: "/user-status/3?ids=2", status: http.StatusForbidden},
+		{path: "/balance/3/stream?ids=2", status: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.path, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tc.path, nil)
+			BearerCredentials(token)(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.status {
+				t.Errorf("unspected status, want: %d, got: %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errBatchUnsupported is returned when the server has no batch endpoints.
+var errBatchUnsupported = errors.New("batch endpoints not supported")
+
+// UserStatusResult is the status of a single user of a batch lookup.
+type UserStatusResult struct {
+	UserID string
+	Status UserStatus
+	Err    error
+}
+
+// WithBatching sets how many users are coalesced in a single batch call and
+// how many calls GetUserStatuses keeps in flight.
+func WithBatching(batchSize, concurrency int) ClientOption {
+	return func(c *Client) {
+		c.batchSize = batchSize
+		c.concurrency = concurrency
+	}
+}
+
+// GetUserStatuses gets the status of many users, coalescing them in batch
+// calls when the server supports it and falling back to one lookup per user
+// otherwise. Results keep the order of ids.
+func (c *Client) GetUserStatuses(ctx context.Context, ids []string) []UserStatusResult {
+	unique := dedupe(ids)
+	byID := make(map[string]UserStatusResult, len(unique))
+	var mu sync.Mutex
+	save := func(r UserStatusResult) {
+		mu.Lock()
+		byID[r.UserID] = r
+		mu.Unlock()
+	}
+
+	var fallback []string
+	if !c.batchUnsupported.Load() {
+		batches := chunk(unique, c.batchSize)
+		boundedEach(len(batches), c.concurrency, func(i int) {
+			statuses, err := c.getBatch(ctx, batches[i])
+			if errors.Is(err, errBatchUnsupported) {
+				c.batchUnsupported.Store(true)
+				mu.Lock()
+				fallback = append(fallback, batches[i]...)
+				mu.Unlock()
+				return
+			}
+			for _, id := range batches[i] {
+				status, ok := statuses[id]
+				switch {
+				case err != nil:
+					save(UserStatusResult{UserID: id, Err: err})
+				case !ok:
+					save(UserStatusResult{UserID: id, Err: fmt.Errorf("user %s missing from batch response", id)})
+				default:
+					save(UserStatusResult{UserID: id, Status: status})
+				}
+			}
+		})
+	} else {
+		fallback = unique
+	}
+
+	boundedEach(len(fallback), c.concurrency, func(i int) {
+		status, err := c.GetUserStatus(ctx, fallback[i])
+		save(UserStatusResult{UserID: fallback[i], Status: status, Err: err})
+	})
+
+	results := make([]UserStatusResult, len(ids))
+	for i, id := range ids {
+		results[i] = byID[id]
+	}
+	return results
+}
+
+// getBatch hit the three batch endpoints concurrently for ids.
+func (c *Client) getBatch(ctx context.Context, ids []string) (map[string]UserStatus, error) {
+	query := url.Values{"ids": {strings.Join(ids, ",")}}.Encode()
+	var users []UserDTO
+	var balances []BalanceDTO
+	var debts map[int][]DebtDTO
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i, call := range []struct {
+		path string
+		into interface{}
+	}{
+		{"users", &users},
+		{"balance", &balances},
+		{"user-debts", &debts},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.get(ctx, fmt.Sprintf("%s/%s?%s", c.serverURL, call.path, query))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			// servers without batch routes redirect /users to /users/.
+			redirected := resp.Request != nil && !strings.HasSuffix(resp.Request.URL.Path, "/"+call.path)
+			switch {
+			case resp.StatusCode == http.StatusOK && !redirected:
+				errs[i] = unmarshalResponse(resp, call.into)
+			case redirected, resp.StatusCode == http.StatusNotFound,
+				resp.StatusCode == http.StatusMethodNotAllowed, resp.StatusCode == http.StatusNotImplemented:
+				resp.Body.Close()
+				errs[i] = errBatchUnsupported
+			default:
+				resp.Body.Close()
+				errs[i] = fmt.Errorf("batch %s: unexpected status %d", call.path, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if errors.Is(err, errBatchUnsupported) {
+			return nil, err
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	balanceByID := make(map[int]BalanceDTO, len(balances))
+	for _, b := range balances {
+		balanceByID[b.UserID] = b
+	}
+	statuses := make(map[string]UserStatus, len(users))
+	for _, u := range users {
+		statuses[strconv.Itoa(u.ID)] = newUserStatus(u, balanceByID[u.ID], debts[u.ID])
+	}
+	return statuses, nil
+}
+
+// boundedEach calls fn for every index in [0, n) with at most limit calls
+// running at the same time.
+func boundedEach(n, limit int, fn func(i int)) {
+	if limit <= 0 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+func chunk(ids []string, size int) [][]string {
+	if size <= 0 {
+		size = len(ids)
+	}
+	var chunks [][]string
+	for size < len(ids) {
+		ids, chunks = ids[size:], append(chunks, ids[:size])
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
+
+func dedupe(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	var unique []string
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/jegutierrez/functional_patterns_go/router"
+)
+
+func TestGetUserStatusesBatched(t *testing.T) {
+	counts := newCounts()
+	srv := httptest.NewServer(countingHandler(handler(), counts))
+	defer srv.Close()
+
+	var ids []string
+	for i := 1; i <= 120; i++ {
+		ids = append(ids, fmt.Sprint(i))
+	}
+	ids = append(ids, "7")
+
+	client := NewClient(srv.URL, WithBatching(50, 2))
+	results := client.GetUserStatuses(context.Background(), ids)
+
+	if len(results) != len(ids) {
+		t.Fatalf("unspected results, want %d, got: %d", len(ids), len(results))
+	}
+	for i, r := range results {
+		if r.Err != nil || r.UserID != ids[i] || strconv.Itoa(r.Status.ID) != ids[i] || len(r.Status.Debts) != 3 {
+			t.Errorf("unspected result for %s, got: %+v", ids[i], r)
+		}
+	}
+	for endpoint, c := range counts {
+		if c.Load() != 3 {
+			t.Errorf("unspected %s calls, want 3, got: %d", endpoint, c.Load())
+		}
+	}
+}
+
+func TestGetUserStatusesFallback(t *testing.T) {
+	rt := router.New()
+	rt.HandleFunc(http.MethodGet, "/users/{id:int}", userHandler)
+	rt.HandleFunc(http.MethodGet, "/balance/{id:int}", balanceHandler)
+	rt.HandleFunc(http.MethodGet, "/user-debts/{id:int}", debtsHandler)
+	srv := httptest.NewServer(rt)
+	defer srv.Close()
+
+	ids := []string{"1", "2", "3"}
+	client := NewClient(srv.URL)
+	results := client.GetUserStatuses(context.Background(), ids)
+
+	for i, r := range results {
+		if r.Err != nil || strconv.Itoa(r.Status.ID) != ids[i] {
+			t.Errorf("unspected result for %s, got: %+v", ids[i], r)
+		}
+	}
+	if !client.batchUnsupported.Load() {
+		t.Errorf("client did not detect missing batch endpoints")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerPolicy sets when the circuit of an upstream opens and for how long.
+type BreakerPolicy struct {
+	// Failures is how many calls in a row must fail to open the circuit.
+	Failures int
+	// Cooldown is how long the circuit stays open before a probe call is
+	// let through.
+	Cooldown time.Duration
+}
+
+// DefaultBreakerPolicy opens after 5 failures in a row, probing again after
+// 10 seconds.
+var DefaultBreakerPolicy = BreakerPolicy{
+	Failures: 5,
+	Cooldown: 10 * time.Second,
+}
+
+// ErrCircuitOpen is returned, without calling the upstream, while its
+// circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// BreakerState is the state of the circuit of an upstream.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen lets a single probe call through.
+	BreakerHalfOpen
+	// BreakerOpen fails calls right away.
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Breakers keeps a circuit breaker per upstream, keyed by the first path
+// segment of the calls. Clients sharing Breakers share their circuits.
+type Breakers struct {
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreakers creates closed circuits following policy.
+func NewBreakers(policy BreakerPolicy) *Breakers {
+	return &Breakers{policy: policy, now: time.Now, circuits: map[string]*circuit{}}
+}
+
+// State returns the state of the circuit of upstream.
+func (b *Breakers) State(upstream string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[upstream]; ok {
+		return c.state
+	}
+	return BreakerClosed
+}
+
+// Open returns the upstreams whose circuit is not closed, sorted.
+func (b *Breakers) Open() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var open []string
+	for upstream, c := range b.circuits {
+		if c.state != BreakerClosed {
+			open = append(open, upstream)
+		}
+	}
+	sort.Strings(open)
+	return open
+}
+
+func (b *Breakers) circuit(upstream string) *circuit {
+	c, ok := b.circuits[upstream]
+	if !ok {
+		c = &circuit{}
+		b.circuits[upstream] = c
+	}
+	return c
+}
+
+// allow tells if a call to upstream may go through, turning an open
+// circuit half-open once its cooldown is over.
+func (b *Breakers) allow(upstream string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(upstream)
+	switch c.state {
+	case BreakerOpen:
+		if b.now().Sub(c.openedAt) < b.policy.Cooldown {
+			return false
+		}
+		c.state = BreakerHalfOpen
+	case BreakerHalfOpen:
+		if c.probing {
+			return false
+		}
+	default:
+		return true
+	}
+	c.probing = true
+	return true
+}
+
+// record closes the circuit of upstream after a success, and opens it
+// after a failed probe or enough failures in a row.
+func (b *Breakers) record(upstream string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(upstream)
+	c.probing = false
+	if !failed {
+		c.state, c.failures = BreakerClosed, 0
+		return
+	}
+	c.failures++
+	if c.state == BreakerHalfOpen || c.failures >= b.policy.Failures {
+		c.state, c.openedAt = BreakerOpen, b.now()
+	}
+}
+
+// release lets another probe through, when the one in flight ended without
+// telling whether upstream recovered.
+func (b *Breakers) release(upstream string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.circuit(upstream).probing = false
+}
+
+// guarded decorates fetch so calls to an upstream with an open circuit
+// fail with ErrCircuitOpen. Transport errors and 5xx responses count as
+// failures, calls canceled by the caller don't count. onState is told the
+// state of the upstream after every call.
+func (b *Breakers) guarded(fetch fetchFunc, onState func(upstream string, state BreakerState)) fetchFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		upstream := endpointOf(req.URL)
+		if !b.allow(upstream) {
+			onState(upstream, b.State(upstream))
+			return nil, ErrCircuitOpen
+		}
+		resp, err := fetch(req)
+		if err != nil && req.Context().Err() != nil {
+			// the caller gave up, the upstream may be fine.
+			b.release(upstream)
+		} else {
+			b.record(upstream, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+		}
+		onState(upstream, b.State(upstream))
+		return resp, err
+	}
+}
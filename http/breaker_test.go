@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls atomic.Int64
+	var failing atomic.Bool
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	breakers := NewBreakers(BreakerPolicy{Failures: 2, Cooldown: time.Second})
+	breakers.now = func() time.Time { return now }
+	client := NewClient(srv.URL, WithCircuitBreaker(breakers))
+	call := func() error {
+		resp, err := client.get(context.Background(), srv.URL+"/balance/2")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	tt := []struct {
+		name  string
+		setup func()
+		err   error
+		calls int64
+		state BreakerState
+	}{
+		{name: "first failure", setup: func() {}, calls: 1, state: BreakerClosed},
+		{name: "opens", setup: func() {}, calls: 2, state: BreakerOpen},
+		{name: "fails fast", setup: func() {}, err: ErrCircuitOpen, calls: 2, state: BreakerOpen},
+		{name: "failed probe", setup: func() { now = now.Add(time.Second) }, calls: 3, state: BreakerOpen},
+		{name: "closes", setup: func() { now = now.Add(time.Second); failing.Store(false) }, calls: 4, state: BreakerClosed},
+	}
+
+	for _, tc := range tt {
+		tc.setup()
+		if err := call(); !errors.Is(err, tc.err) {
+			t.Errorf("%s: unspected error, want: %v, got: %v", tc.name, tc.err, err)
+		}
+		if calls.Load() != tc.calls || breakers.State("balance") != tc.state {
+			t.Errorf("%s: unspected breaker, want: %d calls %s, got: %d calls %s", tc.name, tc.calls, tc.state, calls.Load(), breakers.State("balance"))
+		}
+	}
+	if breakers.State("users") != BreakerClosed {
+		t.Errorf("unspected users circuit, want: closed, got: %s", breakers.State("users"))
+	}
+}
+
+func TestBreakerReadinessCheck(t *testing.T) {
+	breakers := NewBreakers(BreakerPolicy{Failures: 1, Cooldown: time.Minute})
+	lc := lifecycle.New(lifecycle.Unmanaged(), lifecycle.WithCheckCacheTTL(0))
+	registerBreakerCheck(lc, breakers)
+
+	for _, tc := range []struct {
+		name   string
+		status int
+		err    string
+	}{
+		{name: "closed", status: http.StatusOK},
+		{name: "open", status: http.StatusServiceUnavailable, err: "circuit not closed for balance"},
+	} {
+		if tc.name == "open" {
+			breakers.record("balance", true)
+		}
+		rr := httptest.NewRecorder()
+		lc.ReadinessHandler()(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report lifecycle.Report
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		var checkErr string
+		for _, check := range report.Checks {
+			if check.Name == "circuit breakers" {
+				checkErr = check.Error
+			}
+		}
+		if rr.Code != tc.status || checkErr != tc.err {
+			t.Errorf("%s: unspected readiness, want: %d %q, got: %d %+v", tc.name, tc.status, tc.err, rr.Code, report)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachePolicy sets how long responses of each endpoint are kept.
+type CachePolicy struct {
+	// TTL per endpoint, keyed by the first path segment, e.g. "balance".
+	TTL map[string]time.Duration
+	// DefaultTTL applies to endpoints missing from TTL.
+	DefaultTTL time.Duration
+	// StaleWhileRevalidate is how long an expired response may still be
+	// served while it is refreshed in background.
+	StaleWhileRevalidate time.Duration
+	// MaxEntries bounds how many responses are kept, dropping the least
+	// recently used ones. Zero means defaultMaxCacheEntries.
+	MaxEntries int
+}
+
+// defaultMaxCacheEntries is the MaxEntries of policies without one.
+const defaultMaxCacheEntries = 1000
+
+// cacheFetchTimeout bounds the upstream calls shared by collapsed misses,
+// which outlive the request that started them.
+const cacheFetchTimeout = 30 * time.Second
+
+// DefaultCachePolicy keeps user info for long and balances only briefly.
+var DefaultCachePolicy = CachePolicy{
+	TTL: map[string]time.Duration{
+		"users":      10 * time.Minute,
+		"balance":    5 * time.Second,
+		"user-debts": time.Minute,
+	},
+	StaleWhileRevalidate: 30 * time.Second,
+}
+
+// ResponseCache stores upstream responses in memory.
+type ResponseCache struct {
+	policy  CachePolicy
+	now     func() time.Time
+	flights flightGroup
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// recent holds the entries, the most recently used first.
+	recent *list.List
+
+	Hits          atomic.Int64
+	StaleHits     atomic.Int64
+	Misses        atomic.Int64
+	Revalidations atomic.Int64
+}
+
+// NewResponseCache creates an empty cache following policy.
+func NewResponseCache(policy CachePolicy) *ResponseCache {
+	return &ResponseCache{
+		policy:  policy,
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+	}
+}
+
+// WithCache serves repeated calls from cache, which sits in front of every
+// other decorator. Clients sharing a cache only share the responses of
+// calls made with the same credentials.
+func WithCache(cache *ResponseCache) ClientOption {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+type cacheEntry struct {
+	key        string
+	status     int
+	header     http.Header
+	body       []byte
+	etag       string
+	vary       http.Header
+	expires    time.Time
+	staleUntil time.Time
+	storable   bool
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+func (c *ResponseCache) lookup(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.recent.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+// store keeps e under key, or forgets key when e is not storable, and
+// drops the least recently used entries beyond the policy MaxEntries.
+func (c *ResponseCache) store(key string, e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !e.storable {
+		if ok {
+			c.recent.Remove(el)
+			delete(c.entries, key)
+		}
+		return
+	}
+	e.key = key
+	if ok {
+		el.Value = e
+		c.recent.MoveToFront(el)
+	} else {
+		c.entries[key] = c.recent.PushFront(e)
+	}
+
+	max := c.policy.MaxEntries
+	if max <= 0 {
+		max = defaultMaxCacheEntries
+	}
+	for c.recent.Len() > max {
+		oldest := c.recent.Remove(c.recent.Back()).(*cacheEntry)
+		delete(c.entries, oldest.key)
+	}
+}
+
+// cached decorates fetch so GET responses are served from c while fresh.
+// Concurrent misses for the same URL collapse into a single upstream call.
+// authenticate returns the request as fetch sends it upstream, with its
+// credentials, which are part of the cache key; responses are only reused
+// for requests with the same values of the headers named by their Vary.
+func (c *ResponseCache) cached(fetch fetchFunc, authenticate func(*http.Request) *http.Request) fetchFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet {
+			return fetch(req)
+		}
+		upstream := authenticate(req)
+		key := credentialKey(upstream) + " " + req.URL.String()
+		now := c.now()
+		cached, ok := c.lookup(key)
+		if ok && !cached.matches(upstream) {
+			cached, ok = nil, false
+		}
+		switch {
+		case ok && now.Before(cached.expires):
+			c.Hits.Add(1)
+			return cached.response(req), nil
+		case ok && now.Before(cached.staleUntil):
+			c.StaleHits.Add(1)
+			background := req.Clone(context.WithoutCancel(req.Context()))
+			go c.refresh(fetch, background, upstream, key, cached)
+			return cached.response(req), nil
+		}
+
+		c.Misses.Add(1)
+		e, err := c.refresh(fetch, req, upstream, key, cached)
+		if err != nil {
+			return nil, err
+		}
+		// a concurrent call collapsed with this one may vary differently.
+		if !e.matches(upstream) {
+			return fetch(req)
+		}
+		return e.response(req), nil
+	}
+}
+
+// refresh fetches key upstream, revalidating prev with its ETag if any.
+// upstream is req with its credentials, to record the values it varies on.
+func (c *ResponseCache) refresh(fetch fetchFunc, req, upstream *http.Request, key string, prev *cacheEntry) (*cacheEntry, error) {
+	return c.flights.do(req.Context(), key, func() (*cacheEntry, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), cacheFetchTimeout)
+		defer cancel()
+		req := req.Clone(ctx)
+		if prev != nil && prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+			c.Revalidations.Add(1)
+		}
+		resp, err := fetch(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		var e cacheEntry
+		if resp.StatusCode == http.StatusNotModified && prev != nil {
+			e = *prev
+		} else {
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			e = cacheEntry{
+				status: resp.StatusCode,
+				header: resp.Header.Clone(),
+				body:   body,
+				etag:   resp.Header.Get("ETag"),
+				vary:   varyValues(resp.Header, upstream),
+			}
+		}
+		c.expire(&e, req, resp.Header)
+		if e.vary == nil {
+			e.storable = false
+		}
+		c.store(key, &e)
+		return &e, nil
+	})
+}
+
+// expire sets the freshness of e from the policy, overridden by the
+// Cache-Control directives sent by the server.
+func (c *ResponseCache) expire(e *cacheEntry, req *http.Request, header http.Header) {
+	ttl, ok := c.policy.TTL[endpointOf(req.URL)]
+	if !ok {
+		ttl = c.policy.DefaultTTL
+	}
+	swr := c.policy.StaleWhileRevalidate
+	e.storable = e.status == http.StatusOK
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		e.storable = false
+	}
+	if _, ok := directives["no-cache"]; ok {
+		ttl, swr = 0, 0
+	}
+	if v, ok := directives["max-age"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil {
+			ttl = time.Duration(secs) * time.Second
+		}
+	}
+	if v, ok := directives["stale-while-revalidate"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil {
+			swr = time.Duration(secs) * time.Second
+		}
+	}
+	if ttl <= 0 && e.etag == "" {
+		e.storable = false
+	}
+
+	now := c.now()
+	e.expires = now.Add(ttl)
+	e.staleUntil = e.expires.Add(swr)
+}
+
+// credentialKey identifies the credentials of req without keeping them.
+func credentialKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Header.Get("Authorization") + "\n" + req.Header.Get("X-API-Key")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// varyValues returns the values req has for the headers named by the Vary
+// header, or nil when the response varies on everything (Vary: *).
+func varyValues(header http.Header, req *http.Request) http.Header {
+	values := http.Header{}
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil
+			}
+			if name != "" {
+				values[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+			}
+		}
+	}
+	return values
+}
+
+// matches tells if e may answer req, sending the headers e varies on with
+// the same values as the request that stored e.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, values := range e.vary {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCacheControl splits a Cache-Control header into its directives.
+func parseCacheControl(h string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(h, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
+
+// flightGroup collapses concurrent calls with the same key into one, run
+// in background so any caller may stop waiting for it.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+}
+
+// do waits for the call of key in flight, starting fn when there is none,
+// until it ends or ctx is done.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (*cacheEntry, error)) (*cacheEntry, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flight{}
+	}
+	f, ok := g.calls[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		g.calls[key] = f
+		go func() {
+			f.entry, f.err = fn()
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.entry, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler counts the requests received per endpoint.
+func countingHandler(h http.Handler, counts map[string]*atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := counts[endpointOf(r.URL)]; ok {
+			c.Add(1)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newCounts() map[string]*atomic.Int64 {
+	return map[string]*atomic.Int64{
+		"users":      {},
+		"balance":    {},
+		"user-debts": {},
+	}
+}
+
+func TestCacheCollapsesConcurrentCalls(t *testing.T) {
+	counts := newCounts()
+	srv := httptest.NewServer(countingHandler(handler(), counts))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithCache(NewResponseCache(DefaultCachePolicy)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := client.GetUserStatus(context.Background(), "2")
+			if err != nil || result.ID != 2 {
+				t.Errorf("unspected result, want 2, got: %d (%v)", result.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for endpoint, c := range counts {
+		if c.Load() != 1 {
+			t.Errorf("unspected %s calls, want 1, got: %d", endpoint, c.Load())
+		}
+	}
+}
+
+func TestCachePerSectionTTL(t *testing.T) {
+	counts := newCounts()
+	srv := httptest.NewServer(countingHandler(handler(), counts))
+	defer srv.Close()
+
+	now := time.Now()
+	cache := NewResponseCache(CachePolicy{
+		TTL:        map[string]time.Duration{"users": time.Hour, "balance": time.Second},
+		DefaultTTL: time.Hour,
+	})
+	cache.now = func() time.Time { return now }
+	client := NewClient(srv.URL, WithCache(cache))
+
+	if _, err := client.GetUserStatus(context.Background(), "2"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Second)
+	if _, err := client.GetUserStatus(context.Background(), "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"users": 1, "balance": 2, "user-debts": 1}
+	for endpoint, c := range counts {
+		if c.Load() != want[endpoint] {
+			t.Errorf("unspected %s calls, want %d, got: %d", endpoint, want[endpoint], c.Load())
+		}
+	}
+}
+
+func TestCacheRevalidatesWithETag(t *testing.T) {
+	var calls, notModified atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, `{"id":"2"}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithCache(NewResponseCache(DefaultCachePolicy)))
+	for i := 0; i < 2; i++ {
+		resp, err := client.get(context.Background(), srv.URL+"/users/2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != `{"id":"2"}` {
+			t.Errorf("unspected response, got: %d %s", resp.StatusCode, body)
+		}
+	}
+
+	if calls.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("unspected calls, want 2 calls and 1 revalidation, got: %d calls, %d revalidations", calls.Load(), notModified.Load())
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int64
+	refreshed := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		io.WriteString(w, strings.Repeat("v", int(n)))
+		if n > 1 {
+			refreshed <- struct{}{}
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	cache := NewResponseCache(CachePolicy{})
+	cache.now = func() time.Time { return now }
+	client := NewClient(srv.URL, WithCache(cache))
+
+	read := func() string {
+		resp, err := client.get(context.Background(), srv.URL+"/balance/2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	read()
+	now = now.Add(5 * time.Second)
+	if body := read(); body != "v" {
+		t.Errorf("unspected stale body, want v, got: %s", body)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not revalidated in background")
+	}
+	if cache.StaleHits.Load() != 1 {
+		t.Errorf("unspected stale hits, want 1, got: %d", cache.StaleHits.Load())
+	}
+}
+
+func TestCacheKeepsCredentialsApart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, r.Header.Get("X-API-Key"))
+	}))
+	defer srv.Close()
+
+	cache := NewResponseCache(DefaultCachePolicy)
+	for _, key := range []string{"alice-key", "bob-key", "alice-key"} {
+		client := NewClient(srv.URL, WithCredentials(APIKeyCredentials(key)), WithCache(cache))
+		resp, err := client.get(context.Background(), srv.URL+"/users/2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != key {
+			t.Errorf("unspected response, want: %s, got: %s", key, body)
+		}
+	}
+	if cache.Misses.Load() != 2 || cache.Hits.Load() != 1 {
+		t.Errorf("unspected cache use, want 2 misses and 1 hit, got: %d misses, %d hits", cache.Misses.Load(), cache.Hits.Load())
+	}
+}
+
+func TestCacheHonorsVary(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		io.WriteString(w, r.Header.Get("Accept-Language"))
+	}))
+	defer srv.Close()
+
+	cache := NewResponseCache(DefaultCachePolicy)
+	fetch := cache.cached(http.DefaultClient.Do, func(req *http.Request) *http.Request { return req })
+	for _, lang := range []string{"es", "en", "en"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users/2", nil)
+		req.Header.Set("Accept-Language", lang)
+		resp, err := fetch(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != lang {
+			t.Errorf("unspected response, want: %s, got: %s", lang, body)
+		}
+	}
+	if cache.Hits.Load() != 1 {
+		t.Errorf("unspected hits, want: 1, got: %d", cache.Hits.Load())
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	cache := NewResponseCache(CachePolicy{MaxEntries: 2})
+	client := NewClient(srv.URL, WithCache(cache))
+	for _, user := range []string{"1", "2", "1", "3", "1", "2"} {
+		resp, err := client.get(context.Background(), srv.URL+"/users/"+user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if cache.Hits.Load() != 2 || cache.Misses.Load() != 4 {
+		t.Errorf("unspected cache use, want 2 hits and 4 misses, got: %d hits, %d misses", cache.Hits.Load(), cache.Misses.Load())
+	}
+	if len(cache.entries) != 2 || cache.recent.Len() != 2 {
+		t.Errorf("unspected entries, want: 2, got: %d", len(cache.entries))
+	}
+}
+
+func TestCacheFlightOutlivesCanceledCaller(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cache := NewResponseCache(DefaultCachePolicy)
+	fetch := cache.cached(http.DefaultClient.Do, func(req *http.Request) *http.Request { return req })
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/users/2", nil)
+		_, err := fetch(req)
+		first <- err
+	}()
+	<-started
+	second := make(chan string)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users/2", nil)
+		resp, err := fetch(req)
+		if err != nil {
+			second <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		second <- string(body)
+	}()
+	for cache.Misses.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("unspected error of the canceled caller, want: %v, got: %v", context.Canceled, err)
+	}
+	release <- struct{}{}
+	if body := <-second; body != "ok" {
+		t.Errorf("unspected response of the collapsed caller, want: ok, got: %s", body)
+	}
+}
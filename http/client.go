@@ -1,111 +1,375 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/jegutierrez/functional_patterns_go/tracing"
 )
 
 // UserStatus represents user data, balance and debts
 type UserStatus struct {
-	ID            string              `json:"id"`
-	Name          string              `json:"name"`
-	BalanceAmount string              `json:"balance_amount"`
-	Debts         []map[string]string `json:"debts"`
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	BalanceAmount Money     `json:"balance_amount"`
+	Debts         []DebtDTO `json:"debts"`
+}
+
+// newUserStatus joins the responses of the three endpoints.
+func newUserStatus(user UserDTO, balance BalanceDTO, debts []DebtDTO) UserStatus {
+	return UserStatus{
+		ID:            user.ID,
+		Name:          user.Name,
+		BalanceAmount: balance.Amount,
+		Debts:         debts,
+	}
+}
+
+// decodeUserStatus decodes the responses of the three endpoints and joins
+// them, fetching with get the pages of debts after the first one.
+func decodeUserStatus(userResponse, balanceResponse, debtsResponse *http.Response, get getFunc) (UserStatus, error) {
+	var userInfo UserDTO
+	userErr := unmarshalResponse(userResponse, &userInfo)
+	var userBalance BalanceDTO
+	balanceErr := unmarshalResponse(balanceResponse, &userBalance)
+	userDebts, debtsErr := unmarshalDebts(debtsResponse, get)
+	if err := errors.Join(userErr, balanceErr, debtsErr); err != nil {
+		return UserStatus{}, err
+	}
+	return newUserStatus(userInfo, userBalance, userDebts), nil
+}
+
+// getFunc performs a GET request to url.
+type getFunc func(url string) (*http.Response, error)
+
+// maxDebtPages bounds the pages of debts followed for a user, so a server
+// handing out cursors forever can't hold the client.
+const maxDebtPages = 100
+
+// unmarshalDebts decodes the debts of resp and of every page after it,
+// following the next link of each page with get.
+func unmarshalDebts(resp *http.Response, get getFunc) ([]DebtDTO, error) {
+	var debts []DebtDTO
+	for page := 1; ; page++ {
+		var pageDebts []DebtDTO
+		if err := unmarshalResponse(resp, &pageDebts); err != nil {
+			return nil, err
+		}
+		debts = append(debts, pageDebts...)
+		next := nextLink(resp)
+		if next == "" {
+			return debts, nil
+		}
+		if page == maxDebtPages {
+			return nil, fmt.Errorf("user-debts: more than %d pages", maxDebtPages)
+		}
+		var err error
+		if resp, err = get(next); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// nextLink returns the URL of the rel="next" Link of resp, resolved
+// against its request, or empty when resp is the last page.
+func nextLink(resp *http.Response) string {
+	for _, link := range strings.Split(resp.Header.Get("Link"), ",") {
+		target, params, _ := strings.Cut(strings.TrimSpace(link), ";")
+		if !strings.Contains(params, `rel="next"`) || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		next, err := url.Parse(strings.Trim(target, "<>"))
+		if err != nil {
+			return ""
+		}
+		if resp.Request != nil {
+			next = resp.Request.URL.ResolveReference(next)
+		}
+		return next.String()
+	}
+	return ""
+}
+
+// defaultTracer traces the calls of the GetUserStatus functions and the
+// requests served by handler(). Recording nothing unless tests swap it.
+var defaultTracer = tracing.Noop()
+
+// startUserStatus starts the root span of a GetUserStatus fan-out, the
+// upstream calls are its children.
+func startUserStatus(ctx context.Context, tracer tracing.Tracer, strategy, userID string) (context.Context, tracing.Span) {
+	return tracer.Start(ctx, "GetUserStatus", tracing.WithAttributes(
+		tracing.Attr("strategy", strategy),
+		tracing.Attr("user_id", userID),
+	))
 }
 
 // GetUserStatusSync hit necessary endpoints and join user's data sync.
 func GetUserStatusSync(serverURL, userID string) (UserStatus, error) {
-	userResponse, _ := http.Get(fmt.Sprintf("%s/users/%s", serverURL, userID))
-	balanceResponse, _ := http.Get(fmt.Sprintf("%s/balance/%s", serverURL, userID))
-	debtsResponse, _ := http.Get(fmt.Sprintf("%s/user-debts/%s", serverURL, userID))
-	var userInfo map[string]string
-	unmarshalResponse(userResponse, &userInfo)
-	var userBalance map[string]string
-	unmarshalResponse(balanceResponse, &userBalance)
-	var userDebts []map[string]string
-	unmarshalResponse(debtsResponse, &userDebts)
-	return UserStatus{
-		ID:            userInfo["id"],
-		Name:          userInfo["name"],
-		BalanceAmount: userBalance["amount"],
-		Debts:         userDebts,
-	}, nil
+	ctx, span := startUserStatus(context.Background(), defaultTracer, "sync", userID)
+	defer span.End()
+	userResponse, userErr := authGet(ctx, fmt.Sprintf("%s/users/%s", serverURL, userID))
+	balanceResponse, balanceErr := authGet(ctx, fmt.Sprintf("%s/balance/%s", serverURL, userID))
+	debtsResponse, debtsErr := authGet(ctx, fmt.Sprintf("%s/user-debts/%s", serverURL, userID))
+	if err := errors.Join(userErr, balanceErr, debtsErr); err != nil {
+		closeResponses(userResponse, balanceResponse, debtsResponse)
+		span.RecordError(err)
+		return UserStatus{}, err
+	}
+	status, err := decodeUserStatus(userResponse, balanceResponse, debtsResponse, func(next string) (*http.Response, error) {
+		return authGet(ctx, next)
+	})
+	span.RecordError(err)
+	return status, err
 }
 
 // GetUserStatusAsyncWaitGroup hit necessary endpoints and join user's data async with waitgroups.
 func GetUserStatusAsyncWaitGroup(serverURL, userID string) (UserStatus, error) {
+	ctx, span := startUserStatus(context.Background(), defaultTracer, "waitgroup", userID)
+	defer span.End()
 	var waitgroup sync.WaitGroup
 	waitgroup.Add(3)
 	var userResponse, balanceResponse, debtsResponse *http.Response
+	var userErr, balanceErr, debtsErr error
 	go func() {
-		userResponse, _ = http.Get(fmt.Sprintf("%s/users/%s", serverURL, userID))
+		userResponse, userErr = authGet(ctx, fmt.Sprintf("%s/users/%s", serverURL, userID))
 		waitgroup.Done()
 	}()
 	go func() {
-		balanceResponse, _ = http.Get(fmt.Sprintf("%s/balance/%s", serverURL, userID))
+		balanceResponse, balanceErr = authGet(ctx, fmt.Sprintf("%s/balance/%s", serverURL, userID))
 		waitgroup.Done()
 	}()
 	go func() {
-		debtsResponse, _ = http.Get(fmt.Sprintf("%s/user-debts/%s", serverURL, userID))
+		debtsResponse, debtsErr = authGet(ctx, fmt.Sprintf("%s/user-debts/%s", serverURL, userID))
 		waitgroup.Done()
 	}()
 	waitgroup.Wait()
-	var userInfo map[string]string
-	unmarshalResponse(userResponse, &userInfo)
-	var userBalance map[string]string
-	unmarshalResponse(balanceResponse, &userBalance)
-	var userDebts []map[string]string
-	unmarshalResponse(debtsResponse, &userDebts)
-	return UserStatus{
-		ID:            userInfo["id"],
-		Name:          userInfo["name"],
-		BalanceAmount: userBalance["amount"],
-		Debts:         userDebts,
-	}, nil
+	if err := errors.Join(userErr, balanceErr, debtsErr); err != nil {
+		closeResponses(userResponse, balanceResponse, debtsResponse)
+		span.RecordError(err)
+		return UserStatus{}, err
+	}
+	status, err := decodeUserStatus(userResponse, balanceResponse, debtsResponse, func(next string) (*http.Response, error) {
+		return authGet(ctx, next)
+	})
+	span.RecordError(err)
+	return status, err
 }
 
 // GetUserStatusAsyncChannels hit necessary endpoints and join user's data async with waitgroups.
 func GetUserStatusAsyncChannels(serverURL, userID string) (UserStatus, error) {
+	ctx, span := startUserStatus(context.Background(), defaultTracer, "channels", userID)
+	defer span.End()
 
-	userResponse := make(chan *http.Response)
-	balanceResponse := make(chan *http.Response)
-	debtsResponse := make(chan *http.Response)
+	userResponse := make(chan getResult)
+	balanceResponse := make(chan getResult)
+	debtsResponse := make(chan getResult)
 	defer close(userResponse)
 	defer close(balanceResponse)
 	defer close(debtsResponse)
 
 	go func() {
-		result, _ := http.Get(fmt.Sprintf("%s/users/%s", serverURL, userID))
-		userResponse <- result
+		result, err := authGet(ctx, fmt.Sprintf("%s/users/%s", serverURL, userID))
+		userResponse <- getResult{result, err}
 	}()
 	go func() {
-		result, _ := http.Get(fmt.Sprintf("%s/balance/%s", serverURL, userID))
-		balanceResponse <- result
+		result, err := authGet(ctx, fmt.Sprintf("%s/balance/%s", serverURL, userID))
+		balanceResponse <- getResult{result, err}
 	}()
 	go func() {
-		result, _ := http.Get(fmt.Sprintf("%s/user-debts/%s", serverURL, userID))
-		debtsResponse <- result
+		result, err := authGet(ctx, fmt.Sprintf("%s/user-debts/%s", serverURL, userID))
+		debtsResponse <- getResult{result, err}
 	}()
 
-	var userInfo map[string]string
-	unmarshalResponse(<-userResponse, &userInfo)
-	var userBalance map[string]string
-	unmarshalResponse(<-balanceResponse, &userBalance)
-	var userDebts []map[string]string
-	unmarshalResponse(<-debtsResponse, &userDebts)
-	return UserStatus{
-		ID:            userInfo["id"],
-		Name:          userInfo["name"],
-		BalanceAmount: userBalance["amount"],
-		Debts:         userDebts,
-	}, nil
+	user, balance, debts := <-userResponse, <-balanceResponse, <-debtsResponse
+	if err := errors.Join(user.err, balance.err, debts.err); err != nil {
+		closeResponses(user.resp, balance.resp, debts.resp)
+		span.RecordError(err)
+		return UserStatus{}, err
+	}
+	status, err := decodeUserStatus(user.resp, balance.resp, debts.resp, func(next string) (*http.Response, error) {
+		return authGet(ctx, next)
+	})
+	span.RecordError(err)
+	return status, err
+}
+
+// getResult is the outcome of a GET request sent over a channel.
+type getResult struct {
+	resp *http.Response
+	err  error
+}
+
+// closeResponses closes the bodies of the responses that were received,
+// when the others failed and none will be decoded.
+func closeResponses(responses ...*http.Response) {
+	for _, resp := range responses {
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// authGet performs a GET request with the default credentials, traced as
+// a child of the span in ctx.
+func authGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defaultCredentials()(req)
+	return traced(http.DefaultClient.Do, defaultTracer)(req)
+}
+
+// fetchFunc performs an upstream request. Decorators such as hedged wrap a
+// fetchFunc to add behavior around every upstream call.
+type fetchFunc func(req *http.Request) (*http.Response, error)
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// Client hit necessary endpoints and join user's data, composing its
+// upstream calls through fetchFunc decorators.
+type Client struct {
+	serverURL   string
+	httpClient  *http.Client
+	credentials Credentials
+	fetch       fetchFunc
+	cache       *ResponseCache
+	metrics     *clientMetrics
+	tracer      tracing.Tracer
+
+	batchSize        int
+	concurrency      int
+	batchUnsupported atomic.Bool
+}
+
+// NewClient creates a client for serverURL with the given options applied.
+func NewClient(serverURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		serverURL:   serverURL,
+		httpClient:  http.DefaultClient,
+		credentials: defaultCredentials(),
+		tracer:      tracing.Noop(),
+		batchSize:   50,
+		concurrency: 4,
+	}
+	c.fetch = func(req *http.Request) (*http.Response, error) {
+		c.credentials(req)
+		return c.httpClient.Do(req)
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cache != nil {
+		// in front of every other decorator, whatever the option order.
+		c.fetch = c.cache.cached(c.fetch, func(req *http.Request) *http.Request {
+			authenticated := req.Clone(req.Context())
+			c.credentials(authenticated)
+			return authenticated
+		})
+	}
+	return c
+}
+
+// WithHTTPClient sets the underlying http client used for every call.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithCredentials authenticates every call with creds.
+func WithCredentials(creds Credentials) ClientOption {
+	return func(c *Client) {
+		c.credentials = creds
+	}
 }
 
-func unmarshalResponse(r *http.Response, b interface{}) {
-	defer r.Body.Close()
-	bytes, _ := ioutil.ReadAll(r.Body)
-	_ = json.Unmarshal(bytes, &b)
+// WithHedging fires a duplicate call when an upstream takes longer than the
+// delay computed by policy, and keeps the first successful answer. Unset
+// fields of policy take the value of DefaultHedgePolicy.
+func WithHedging(policy HedgePolicy, metrics *HedgeMetrics) ClientOption {
+	return func(c *Client) {
+		c.fetch = hedged(c.fetch, policy, metrics)
+	}
+}
+
+// WithCircuitBreaker fails calls right away while the circuit of their
+// upstream is open in breakers, see BreakerPolicy.
+func WithCircuitBreaker(breakers *Breakers) ClientOption {
+	return func(c *Client) {
+		// metrics may be set by a later option.
+		c.fetch = breakers.guarded(c.fetch, func(upstream string, state BreakerState) { c.metrics.breakerState(upstream, state) })
+	}
+}
+
+func (c *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	return c.fetch(req)
+}
+
+// GetUserStatus hit necessary endpoints concurrently and join user's data.
+func (c *Client) GetUserStatus(ctx context.Context, userID string) (status UserStatus, err error) {
+	ctx, span := startUserStatus(ctx, c.tracer, "concurrent", userID)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	call := func(path string) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			resp, err := c.get(ctx, fmt.Sprintf("%s/%s/%s", c.serverURL, path, userID))
+			ch <- result{resp, err}
+		}()
+		return ch
+	}
+	userCall, balanceCall, debtsCall := call("users"), call("balance"), call("user-debts")
+	userResult, balanceResult, debtsResult := <-userCall, <-balanceCall, <-debtsCall
+	for _, r := range []result{userResult, balanceResult, debtsResult} {
+		if r.err != nil {
+			for _, r := range []result{userResult, balanceResult, debtsResult} {
+				if r.resp != nil {
+					r.resp.Body.Close()
+				}
+			}
+			return UserStatus{}, r.err
+		}
+	}
+
+	return decodeUserStatus(userResult.resp, balanceResult.resp, debtsResult.resp, func(next string) (*http.Response, error) {
+		return c.get(ctx, next)
+	})
+}
+
+// GetUserStatusAggregated asks the server to join user's data, in a single
+// call to /user-status.
+func (c *Client) GetUserStatusAggregated(ctx context.Context, userID string) (status UserStatus, err error) {
+	ctx, span := startUserStatus(ctx, c.tracer, "aggregated", userID)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	resp, err := c.get(ctx, fmt.Sprintf("%s/user-status/%s", c.serverURL, userID))
+	if err != nil {
+		return UserStatus{}, err
+	}
+	if err := unmarshalResponse(resp, &status); err != nil {
+		return UserStatus{}, err
+	}
+	return status, nil
 }
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"log"
+	"errors"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -17,11 +18,11 @@ func TestGetUserStatusSync(t *testing.T) {
 	result, _ := GetUserStatusSync(srv.URL, userID)
 
 	elapsed := time.Since(start)
-	log.Printf("GetUserStatusSync took %s\n", elapsed)
-	log.Printf("%+v\n", result)
+	t.Logf("GetUserStatusSync took %s", elapsed)
+	t.Logf("%+v", result)
 
-	if result.ID != userID {
-		t.Errorf("unspected result, want %s, got: %s", userID, result.ID)
+	if strconv.Itoa(result.ID) != userID {
+		t.Errorf("unspected result, want %s, got: %d", userID, result.ID)
 	}
 }
 
@@ -35,11 +36,11 @@ func TestGetUserStatusAsyncWaitgroups(t *testing.T) {
 	result, _ := GetUserStatusAsyncWaitGroup(srv.URL, userID)
 
 	elapsed := time.Since(start)
-	log.Printf("GetUserStatusAsyncWaitGroup took %s\n", elapsed)
-	log.Printf("%+v\n", result)
+	t.Logf("GetUserStatusAsyncWaitGroup took %s", elapsed)
+	t.Logf("%+v", result)
 
-	if result.ID != userID {
-		t.Errorf("unspected result, want %s, got: %s", userID, result.ID)
+	if strconv.Itoa(result.ID) != userID {
+		t.Errorf("unspected result, want %s, got: %d", userID, result.ID)
 	}
 }
 
@@ -53,10 +54,26 @@ func TestGetUserStatusAsyncChannels(t *testing.T) {
 	result, _ := GetUserStatusAsyncChannels(srv.URL, userID)
 
 	elapsed := time.Since(start)
-	log.Printf("GetUserStatusAsyncChannels took %s\n", elapsed)
-	log.Printf("%+v\n", result)
+	t.Logf("GetUserStatusAsyncChannels took %s", elapsed)
+	t.Logf("%+v", result)
 
-	if result.ID != userID {
-		t.Errorf("unspected result, want %s, got: %s", userID, result.ID)
+	if strconv.Itoa(result.ID) != userID {
+		t.Errorf("unspected result, want %s, got: %d", userID, result.ID)
+	}
+}
+
+func TestGetUserStatusUnreachable(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	srv.Close()
+
+	for name, get := range map[string]func(serverURL, userID string) (UserStatus, error){
+		"sync":      GetUserStatusSync,
+		"waitgroup": GetUserStatusAsyncWaitGroup,
+		"channels":  GetUserStatusAsyncChannels,
+	} {
+		_, err := get(srv.URL, "2")
+		if err == nil || errors.Is(err, ErrNoResponse) {
+			t.Errorf("unspected %s error, want the connection error, got: %v", name, err)
+		}
 	}
 }
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/logging"
+	"github.com/jegutierrez/functional_patterns_go/middleware"
+)
+
+// Config of the demo server. It is built from defaults, then a JSON config
+// file, then env vars and finally flags, each one overriding the previous.
+type Config struct {
+	Addr string `json:"addr"`
+	// GRPCAddr serves the gRPC service when set, see grpcServer. It uses
+	// the TLS config of the HTTP server.
+	GRPCAddr string                 `json:"grpc_addr"`
+	TLS      TLSConfig              `json:"tls"`
+	Routes   map[string]RouteConfig `json:"routes"`
+	// RateLimits per route and client, see rateLimitKey.
+	RateLimits map[string]middleware.Limit `json:"rate_limits"`
+	// StatusTimeouts bound how long /user-status and /graphql wait for each
+	// section, keyed by route. Sections without a timeout wait for the request.
+	StatusTimeouts map[string]Duration `json:"status_timeouts"`
+	// Stream sets the behavior of /balance/{id}/stream.
+	Stream StreamConfig `json:"stream"`
+	// Tracing sets where spans are exported, see TracingConfig.
+	Tracing TracingConfig `json:"tracing"`
+	// Log sets how lines are logged, see LogConfig.
+	Log LogConfig `json:"log"`
+	// Shutdown sets how the server drains on SIGINT or SIGTERM.
+	Shutdown ShutdownConfig `json:"shutdown"`
+	// Auth lists the accepted credentials, see KeyFile.
+	Auth KeyFile `json:"auth"`
+	// FaultAdmin enables the /admin/faults endpoint and the X-Fault-Plan
+	// header to change fault plans at runtime.
+	FaultAdmin bool `json:"fault_admin"`
+}
+
+// TLSConfig enables HTTPS when both files are set.
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// StreamConfig sets how often streamed balances change and how often
+// heartbeats are sent on idle streams.
+type StreamConfig struct {
+	Tick      Duration `json:"tick"`
+	Heartbeat Duration `json:"heartbeat"`
+}
+
+// TracingConfig exports spans to an OTLP/HTTP collector when OTLPEndpoint,
+// e.g. http://localhost:4318/v1/traces, is set, or appends them to File,
+// as drawn by tracing/waterfall. Trace context is passed on either way.
+type TracingConfig struct {
+	OTLPEndpoint string `json:"otlp_endpoint"`
+	File         string `json:"file"`
+}
+
+// LogConfig sets the format of the log lines, "text" (the default) or
+// "json", and the lowest level logged, "info" by default.
+type LogConfig struct {
+	Format string `json:"format"`
+	Level  string `json:"level"`
+}
+
+// ShutdownConfig sets how long the server keeps serving once not ready,
+// so load balancers notice it, and how long in-flight requests may take to
+// finish before their connections are closed.
+type ShutdownConfig struct {
+	Delay Duration `json:"delay"`
+	Drain Duration `json:"drain"`
+}
+
+// RouteConfig simulates the behavior of a route, keyed in Config.Routes by
+// its first path segment, e.g. "balance". It doubles as the fault plan of
+// the route, see FaultInjector.
+type RouteConfig struct {
+	Latency Latency `json:"latency"`
+	// ErrorRate is the probability (0..1) of answering an error.
+	ErrorRate float64 `json:"error_rate"`
+	// ErrorCodes to pick from at random when failing, 500 when empty.
+	ErrorCodes []int `json:"error_codes,omitempty"`
+	// DropRate is the probability of closing the connection with no answer.
+	DropRate float64 `json:"drop_rate,omitempty"`
+	// TruncateRate is the probability of sending only half of the body.
+	TruncateRate float64 `json:"truncate_rate,omitempty"`
+	// SlowDrip, when set, sends the body a few bytes at a time waiting
+	// SlowDrip between each write.
+	SlowDrip Duration `json:"slow_drip,omitempty"`
+}
+
+func (rc RouteConfig) validate() error {
+	for name, rate := range map[string]float64{
+		"error_rate":    rc.ErrorRate,
+		"drop_rate":     rc.DropRate,
+		"truncate_rate": rc.TruncateRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+	for _, code := range rc.ErrorCodes {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("error code %d is not a 4xx or 5xx status", code)
+		}
+	}
+	if rc.SlowDrip < 0 {
+		return fmt.Errorf("slow_drip must not be negative")
+	}
+	return rc.Latency.validate()
+}
+
+// Latency is either fixed or drawn from a distribution:
+//
+//	fixed       -> always Mean
+//	uniform     -> between Min and Max
+//	normal      -> Mean with StdDev, clamped to [Min, Max] when set
+//	exponential -> Mean, clamped to [Min, Max] when set
+type Latency struct {
+	Distribution string   `json:"distribution"`
+	Mean         Duration `json:"mean"`
+	StdDev       Duration `json:"stddev"`
+	Min          Duration `json:"min"`
+	Max          Duration `json:"max"`
+}
+
+// Fixed returns a latency that always waits d.
+func Fixed(d time.Duration) Latency {
+	return Latency{Distribution: "fixed", Mean: Duration(d)}
+}
+
+// Sample draws a latency from the distribution.
+func (l Latency) Sample() time.Duration {
+	var d float64
+	switch l.Distribution {
+	case "uniform":
+		d = float64(l.Min) + rand.Float64()*float64(l.Max-l.Min)
+	case "normal":
+		d = float64(l.Mean) + rand.NormFloat64()*float64(l.StdDev)
+	case "exponential":
+		d = rand.ExpFloat64() * float64(l.Mean)
+	default:
+		d = float64(l.Mean)
+	}
+	d = math.Max(d, float64(l.Min))
+	if l.Max > 0 {
+		d = math.Min(d, float64(l.Max))
+	}
+	return time.Duration(d)
+}
+
+func (l Latency) validate() error {
+	switch l.Distribution {
+	case "", "fixed", "normal", "exponential":
+	case "uniform":
+		if l.Max < l.Min {
+			return fmt.Errorf("uniform latency max %s is lower than min %s", l.Max, l.Min)
+		}
+	default:
+		return fmt.Errorf("unknown latency distribution %q", l.Distribution)
+	}
+	return nil
+}
+
+// Duration is a time.Duration written in JSON as "150ms".
+type Duration time.Duration
+
+// String formats d like time.Duration does.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON encodes d as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string such as "1.5s".
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"150ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultConfig serves HTTP on :8080 with the classic demo delays. The
+// gRPC service is opt-in, see GRPCAddr.
+func DefaultConfig() Config {
+	return Config{
+		Addr: ":8080",
+		Stream: StreamConfig{
+			Tick:      Duration(2 * time.Second),
+			Heartbeat: Duration(15 * time.Second),
+		},
+		Shutdown: ShutdownConfig{
+			Drain: Duration(15 * time.Second),
+		},
+		RateLimits: map[string]middleware.Limit{
+			"users":       {Rate: 50, Burst: 100},
+			"balance":     {Rate: 20, Burst: 40},
+			"user-debts":  {Rate: 20, Burst: 40},
+			"user-status": {Rate: 20, Burst: 40},
+			"graphql":     {Rate: 20, Burst: 40},
+		},
+		StatusTimeouts: map[string]Duration{
+			"users":      Duration(time.Second),
+			"balance":    Duration(time.Second),
+			"user-debts": Duration(time.Second),
+		},
+		Routes: map[string]RouteConfig{
+			"users":      {Latency: Fixed(150 * time.Millisecond)},
+			"balance":    {Latency: Fixed(350 * time.Millisecond)},
+			"user-debts": {Latency: Fixed(250 * time.Millisecond)},
+		},
+	}
+}
+
+// Route returns the config of route, or a zero config that adds no latency
+// nor errors.
+func (c Config) Route(route string) RouteConfig {
+	return c.Routes[route]
+}
+
+// Validate checks the loaded config makes sense and brings its own
+// credentials, rejecting the demo ones.
+func (c Config) Validate() error {
+	if err := c.validateSettings(); err != nil {
+		return err
+	}
+	if c.Auth.HMACSecret == "" || c.Auth.HMACSecret == demoHMACSecret {
+		return fmt.Errorf("auth needs its own hmac_secret, see -auth-keys")
+	}
+	for _, key := range c.Auth.APIKeys {
+		if key.Key == "" || key.Key == demoAPIKey {
+			return fmt.Errorf("auth api key of %s must be set and not the demo one", key.Subject)
+		}
+	}
+	return nil
+}
+
+// validateSettings is Validate without the checks of the credentials.
+func (c Config) validateSettings() error {
+	if c.Addr == "" {
+		return fmt.Errorf("addr must not be empty")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls needs both cert_file and key_file")
+	}
+	for name, route := range c.Routes {
+		if err := route.validate(); err != nil {
+			return fmt.Errorf("route %s: %w", name, err)
+		}
+	}
+	for name, limit := range c.RateLimits {
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			return fmt.Errorf("rate limit %s: rate must be positive and burst at least 1", name)
+		}
+	}
+	if c.Stream.Tick < 0 || c.Stream.Heartbeat <= 0 {
+		return fmt.Errorf("stream tick must not be negative and heartbeat must be positive")
+	}
+	if c.Tracing.OTLPEndpoint != "" && c.Tracing.File != "" {
+		return fmt.Errorf("tracing takes an otlp_endpoint or a file, not both")
+	}
+	if _, err := logging.New(io.Discard, c.Log.Format, c.Log.Level); err != nil {
+		return err
+	}
+	if c.Shutdown.Delay < 0 || c.Shutdown.Drain < 0 {
+		return fmt.Errorf("shutdown delay and drain must not be negative")
+	}
+	for name, timeout := range c.StatusTimeouts {
+		if timeout < 0 {
+			return fmt.Errorf("status timeout %s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// LoadConfig builds the config from the defaults, the JSON file given by
+// -config or SERVER_CONFIG, the SERVER_* env vars and the flags in args.
+func LoadConfig(args []string, getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("SERVER_CONFIG"), "path to a JSON config file")
+	addr := fs.String("addr", "", "address to listen on, e.g. :8080")
+	grpcAddr := fs.String("grpc-addr", "", "address of the gRPC service, e.g. :9090")
+	certFile := fs.String("tls-cert", "", "TLS certificate file")
+	keyFile := fs.String("tls-key", "", "TLS key file")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "OTLP/HTTP traces URL spans are exported to, e.g. http://localhost:4318/v1/traces")
+	logFormat := fs.String("log-format", "", "format of the log lines, text or json")
+	logLevel := fs.String("log-level", "", "lowest level logged, e.g. debug or warn")
+	traceFile := fs.String("trace-file", "", "file spans are appended to, e.g. spans.jsonl")
+	authKeys := fs.String("auth-keys", getenv("SERVER_AUTH_KEYS"), "path to a JSON file with the accepted credentials")
+	latencies := routeFlag{}
+	fs.Var(latencies, "latency", "fixed latency of a route, e.g. balance=350ms (repeatable)")
+	errorRates := routeFlag{}
+	fs.Var(errorRates, "error-rate", "error rate of a route, e.g. balance=0.1 (repeatable)")
+	rateLimits := routeFlag{}
+	fs.Var(rateLimits, "rate-limit", "requests per second and burst of a route, e.g. balance=10:20 (repeatable)")
+	drain := fs.Duration("drain-timeout", 0, "how long in-flight requests may take to finish on shutdown, e.g. 30s")
+	faultAdmin := fs.Bool("fault-admin", false, "enable runtime fault plans via /admin/faults and X-Fault-Plan")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for env, dst := range map[string]*string{
+		"SERVER_ADDR":          &cfg.Addr,
+		"SERVER_GRPC_ADDR":     &cfg.GRPCAddr,
+		"SERVER_TLS_CERT":      &cfg.TLS.CertFile,
+		"SERVER_TLS_KEY":       &cfg.TLS.KeyFile,
+		"SERVER_OTLP_ENDPOINT": &cfg.Tracing.OTLPEndpoint,
+		"SERVER_TRACE_FILE":    &cfg.Tracing.File,
+		"SERVER_LOG_FORMAT":    &cfg.Log.Format,
+		"SERVER_LOG_LEVEL":     &cfg.Log.Level,
+	} {
+		if v := getenv(env); v != "" {
+			*dst = v
+		}
+	}
+
+	for _, f := range []struct{ value, dst *string }{
+		{addr, &cfg.Addr},
+		{grpcAddr, &cfg.GRPCAddr},
+		{certFile, &cfg.TLS.CertFile},
+		{keyFile, &cfg.TLS.KeyFile},
+		{otlpEndpoint, &cfg.Tracing.OTLPEndpoint},
+		{traceFile, &cfg.Tracing.File},
+		{logFormat, &cfg.Log.Format},
+		{logLevel, &cfg.Log.Level},
+	} {
+		if *f.value != "" {
+			*f.dst = *f.value
+		}
+	}
+	if *authKeys != "" {
+		keys, err := LoadKeyFile(*authKeys)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Auth = keys
+	}
+	if *drain != 0 {
+		cfg.Shutdown.Drain = Duration(*drain)
+	}
+	if *faultAdmin || getenv("SERVER_FAULT_ADMIN") == "true" {
+		cfg.FaultAdmin = true
+	}
+	for route, v := range latencies {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("-latency %s: %w", route, err)
+		}
+		rc := cfg.Route(route)
+		rc.Latency = Fixed(d)
+		cfg.setRoute(route, rc)
+	}
+	for route, v := range errorRates {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("-error-rate %s: %w", route, err)
+		}
+		rc := cfg.Route(route)
+		rc.ErrorRate = rate
+		cfg.setRoute(route, rc)
+	}
+
+	for route, v := range rateLimits {
+		rate, burst, _ := strings.Cut(v, ":")
+		var limit middleware.Limit
+		var err error
+		if limit.Rate, err = strconv.ParseFloat(rate, 64); err != nil {
+			return Config{}, fmt.Errorf("-rate-limit %s: %w", route, err)
+		}
+		if limit.Burst, err = strconv.Atoi(burst); err != nil {
+			return Config{}, fmt.Errorf("-rate-limit %s: %w", route, err)
+		}
+		if cfg.RateLimits == nil {
+			cfg.RateLimits = map[string]middleware.Limit{}
+		}
+		cfg.RateLimits[route] = limit
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) setRoute(route string, rc RouteConfig) {
+	if c.Routes == nil {
+		c.Routes = map[string]RouteConfig{}
+	}
+	c.Routes[route] = rc
+}
+
+// loadConfigFile overrides cfg with the fields present in the JSON file.
+// Routes present in the file replace the default ones one by one, while
+// auth replaces the accepted credentials as a whole.
+func loadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	defaults, auth := cfg.Routes, cfg.Auth
+	cfg.Routes, cfg.Auth = nil, KeyFile{}
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	for route, rc := range defaults {
+		if _, ok := cfg.Routes[route]; !ok {
+			cfg.setRoute(route, rc)
+		}
+	}
+	if cfg.Auth.HMACSecret == "" && cfg.Auth.APIKeys == nil {
+		cfg.Auth = auth
+	}
+	return nil
+}
+
+// routeFlag collects repeated route=value flags.
+type routeFlag map[string]string
+
+func (f routeFlag) String() string {
+	var pairs []string
+	for route, v := range f {
+		pairs = append(pairs, route+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f routeFlag) Set(s string) error {
+	route, v, ok := strings.Cut(s, "=")
+	if !ok || route == "" {
+		return fmt.Errorf("expected route=value, got %q", s)
+	}
+	f[route] = v
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{
+		"addr": ":9000",
+		"routes": {"balance": {"latency": {"mean": "10ms"}, "error_rate": 0.5}}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"SERVER_CONFIG": file, "SERVER_ADDR": ":9001", "SERVER_AUTH_KEYS": "keys.example.json"}
+
+	cfg, err := LoadConfig([]string{"-latency", "users=5ms", "-error-rate", "balance=0.1"}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Addr != ":9001" {
+		t.Errorf("unspected addr, want :9001, got: %s", cfg.Addr)
+	}
+	if cfg.GRPCAddr != "" {
+		t.Errorf("unspected grpc addr, want gRPC off by default, got: %s", cfg.GRPCAddr)
+	}
+	if got := cfg.Route("balance"); time.Duration(got.Latency.Mean) != 10*time.Millisecond || got.ErrorRate != 0.1 {
+		t.Errorf("unspected balance route, got: %+v", got)
+	}
+	if got := cfg.Route("users").Latency.Sample(); got != 5*time.Millisecond {
+		t.Errorf("unspected users latency, want 5ms, got: %s", got)
+	}
+	if got := cfg.Route("user-debts").Latency.Sample(); got != 250*time.Millisecond {
+		t.Errorf("unspected default user-debts latency, want 250ms, got: %s", got)
+	}
+}
+
+func TestLoadConfigExample(t *testing.T) {
+	cfg, err := LoadConfig([]string{"-config", "config.example.json", "-auth-keys", "keys.example.json"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if d := cfg.Route("balance").Latency.Sample(); d < 50*time.Millisecond || d > 2*time.Second {
+			t.Fatalf("latency out of bounds: %s", d)
+		}
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	demo := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(demo, []byte(`{"hmac_secret": "`+demoHMACSecret+`"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"-auth-keys", "keys.example.json"}
+
+	tt := []struct {
+		name string
+		args []string
+	}{
+		{name: "no auth keys", args: nil},
+		{name: "demo secret", args: []string{"-auth-keys", demo}},
+		{name: "error rate above 1", args: []string{"-error-rate", "balance=2"}},
+		{name: "bad latency", args: []string{"-latency", "balance=fast"}},
+		{name: "cert without key", args: []string{"-tls-cert", "cert.pem"}},
+		{name: "unknown log format", args: []string{"-log-format", "xml"}},
+		{name: "otlp and trace file", args: []string{"-otlp-endpoint", "http://localhost:4318/v1/traces", "-trace-file", "spans.jsonl"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			args := tc.args
+			if !slices.Contains(args, "-auth-keys") && tc.name != "no auth keys" {
+				args = append(args, keys...)
+			}
+			if _, err := LoadConfig(args, func(string) string { return "" }); err == nil {
+				t.Errorf("unspected result, want error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileReplacesAuth(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{
+		"auth": {"hmac_secret": "s3cret", "api_keys": [{"key": "ops-key", "subject": "ops", "scopes": ["users:read"]}]}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := demoConfig()
+	if err := loadConfigFile(file, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := KeyFile{HMACSecret: "s3cret", APIKeys: []APIKey{{Key: "ops-key", Subject: "ops", Scopes: []string{scopeUsersRead}}}}
+	if !reflect.DeepEqual(cfg.Auth, want) {
+		t.Errorf("unspected auth, want: %+v, got: %+v", want, cfg.Auth)
+	}
+}
+
+func TestSimulateErrorRate(t *testing.T) {
+	cfg := demoConfig()
+	cfg.Routes["balance"] = RouteConfig{ErrorRate: 1}
+	srv := httptest.NewServer(newHandler(cfg))
+	defer srv.Close()
+
+	resp, err := authGet(context.Background(), srv.URL+"/balance/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("unspected status, want 500, got: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jegutierrez/functional_patterns_go/filter"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+const (
+	// defaultDebtsLimit is the page size of /user-debts/{id} without limit.
+	defaultDebtsLimit = 50
+	// maxDebtsLimit caps the limit asked to /user-debts/{id}.
+	maxDebtsLimit = 100
+)
+
+// debtSorts are the orders of /user-debts/{id}, by the name of their sort
+// parameter. A leading - reverses them; ties are broken by ascending ID.
+var debtSorts = map[string]func(a, b DebtDTO) int{
+	"id":     func(a, b DebtDTO) int { return cmp.Compare(a.ID, b.ID) },
+	"amount": func(a, b DebtDTO) int { return cmp.Compare(a.Amount, b.Amount) },
+	"reason": func(a, b DebtDTO) int { return strings.Compare(a.Reason, b.Reason) },
+}
+
+// defaultDebts stores the debts served by handler(). Tests put the debts
+// they need for their users.
+var defaultDebts = newDebtStore()
+
+// debtStore holds the debts of each user. Users without stored debts owe
+// the three chargebacks every user of the demo has.
+type debtStore struct {
+	mu    sync.RWMutex
+	debts map[int][]DebtDTO
+}
+
+func newDebtStore() *debtStore {
+	return &debtStore{debts: map[int][]DebtDTO{}}
+}
+
+// Put replaces the debts of userID.
+func (s *debtStore) Put(userID int, debts []DebtDTO) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.debts[userID] = slices.Clone(debts)
+}
+
+// All returns every debt of userID, by ID.
+func (s *debtStore) All(userID int) []DebtDTO {
+	s.mu.RLock()
+	debts, ok := s.debts[userID]
+	s.mu.RUnlock()
+	if !ok {
+		return []DebtDTO{
+			{ID: 14, Reason: "chargeback", Amount: 7100},
+			{ID: 37, Reason: "chargeback", Amount: 1550},
+			{ID: 51, Reason: "chargeback", Amount: 4300},
+		}
+	}
+	debts = slices.Clone(debts)
+	slices.SortFunc(debts, func(a, b DebtDTO) int { return cmp.Compare(a.ID, b.ID) })
+	return debts
+}
+
+// Find returns the page of the debts of userID matching q, and the cursor
+// of the next page, empty on the last one.
+func (s *debtStore) Find(userID int, q debtQuery) ([]DebtDTO, string) {
+	debts := s.All(userID)
+
+	var predicates []func(int) bool
+	if q.reason != "" {
+		predicates = append(predicates, func(i int) bool { return debts[i].Reason == q.reason })
+	}
+	if q.minAmount != nil {
+		predicates = append(predicates, func(i int) bool { return debts[i].Amount >= *q.minAmount })
+	}
+	if q.maxAmount != nil {
+		predicates = append(predicates, func(i int) bool { return debts[i].Amount <= *q.maxAmount })
+	}
+	if q.after != nil {
+		predicates = append(predicates, func(i int) bool { return q.compare(q.after.debt(), debts[i]) < 0 })
+	}
+	matched := []DebtDTO{}
+	filter.Filter(len(debts), filter.And(predicates...), func(i int) {
+		matched = append(matched, debts[i])
+	})
+
+	slices.SortFunc(matched, q.compare)
+	if len(matched) <= q.limit {
+		return matched, ""
+	}
+	page := matched[:q.limit]
+	return page, newDebtCursor(q.sort, page[len(page)-1]).String()
+}
+
+// debtQuery is the filters, order and page asked to /user-debts/{id}.
+type debtQuery struct {
+	reason               string
+	minAmount, maxAmount *Money
+	sort                 string
+	compare              func(a, b DebtDTO) int
+	limit                int
+	after                *debtCursor
+}
+
+// parseDebtQuery reads a debtQuery from the query parameters reason,
+// min_amount, max_amount, sort, limit and cursor of r.
+func parseDebtQuery(r *http.Request) (debtQuery, error) {
+	params := r.URL.Query()
+	q := debtQuery{reason: params.Get("reason"), sort: "id", limit: defaultDebtsLimit}
+
+	for _, amount := range []struct {
+		param string
+		into  **Money
+	}{
+		{"min_amount", &q.minAmount},
+		{"max_amount", &q.maxAmount},
+	} {
+		if value := params.Get(amount.param); value != "" {
+			m, err := ParseMoney(value)
+			if err != nil {
+				return debtQuery{}, problem.BadRequest("%s: %v", amount.param, err)
+			}
+			*amount.into = &m
+		}
+	}
+
+	if value := params.Get("sort"); value != "" {
+		q.sort = value
+	}
+	by, ok := debtSorts[strings.TrimPrefix(q.sort, "-")]
+	if !ok {
+		return debtQuery{}, problem.BadRequest("unknown sort %q", q.sort)
+	}
+	desc := strings.HasPrefix(q.sort, "-")
+	q.compare = func(a, b DebtDTO) int {
+		c := by(a, b)
+		if desc {
+			c = -c
+		}
+		return cmp.Or(c, cmp.Compare(a.ID, b.ID))
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxDebtsLimit {
+			return debtQuery{}, problem.BadRequest("limit %q is not a number between 1 and %d", value, maxDebtsLimit)
+		}
+		q.limit = limit
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		after, err := parseDebtCursor(value)
+		if err != nil || after.Sort != q.sort {
+			return debtQuery{}, problem.BadRequest("cursor %q is not a cursor of sort %s", value, q.sort)
+		}
+		q.after = &after
+	}
+	return q, nil
+}
+
+// debtCursor points past the last debt of a page, keeping the fields the
+// order compares so pages stay consistent while debts change.
+type debtCursor struct {
+	Sort   string `json:"s"`
+	ID     int    `json:"i"`
+	Reason string `json:"r,omitempty"`
+	Amount Money  `json:"a,omitempty"`
+}
+
+func newDebtCursor(sort string, last DebtDTO) debtCursor {
+	return debtCursor{Sort: sort, ID: last.ID, Reason: last.Reason, Amount: last.Amount}
+}
+
+func parseDebtCursor(s string) (debtCursor, error) {
+	var c debtCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	return c, json.Unmarshal(b, &c)
+}
+
+func (c debtCursor) debt() DebtDTO {
+	return DebtDTO{ID: c.ID, Reason: c.Reason, Amount: c.Amount}
+}
+
+// String encodes c as an opaque URL safe token.
+func (c debtCursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// nextPageLink is the Link header value pointing to the page of r after
+// cursor, keeping the rest of its query.
+func nextPageLink(r *http.Request, cursor string) string {
+	params := r.URL.Query()
+	params.Set("cursor", cursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+	return "<" + next.String() + `>; rel="next"`
+}
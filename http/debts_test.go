@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jegutierrez/functional_patterns_go/router"
+)
+
+// userDebts are the debts tests put in the store for user 7.
+var userDebts = []DebtDTO{
+	{ID: 5, Reason: "loan", Amount: 20000},
+	{ID: 1, Reason: "chargeback", Amount: 1550},
+	{ID: 9, Reason: "chargeback", Amount: 7100},
+	{ID: 3, Reason: "fee", Amount: 300},
+	{ID: 7, Reason: "chargeback", Amount: 1550},
+}
+
+func newDebtsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	defaultDebts = newDebtStore()
+	defaultDebts.Put(7, userDebts)
+	t.Cleanup(func() { defaultDebts = newDebtStore() })
+
+	rt := router.New()
+	rt.HandleFunc(http.MethodGet, "/user-debts/{id:int}", debtsHandler)
+	return httptest.NewServer(rt)
+}
+
+func TestDebtsQuery(t *testing.T) {
+	srv := newDebtsServer(t)
+	defer srv.Close()
+
+	tt := []struct {
+		name  string
+		query string
+		ids   []int
+	}{
+		{name: "by id", query: "", ids: []int{1, 3, 5, 7, 9}},
+		{name: "by id desc", query: "sort=-id", ids: []int{9, 7, 5, 3, 1}},
+		{name: "by reason", query: "reason=chargeback", ids: []int{1, 7, 9}},
+		{name: "amount range", query: "min_amount=15.50&max_amount=200", ids: []int{1, 5, 7, 9}},
+		{name: "reason and amount", query: "reason=chargeback&max_amount=20", ids: []int{1, 7}},
+		{name: "by amount", query: "sort=amount", ids: []int{3, 1, 7, 9, 5}},
+		{name: "by amount desc", query: "sort=-amount", ids: []int{5, 9, 1, 7, 3}},
+		{name: "by reason desc", query: "sort=-reason", ids: []int{5, 3, 1, 7, 9}},
+		{name: "no match", query: "reason=tax", ids: []int{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := http.Get(srv.URL + "/user-debts/7?" + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var debts []DebtDTO
+			if err := unmarshalResponse(res, &debts); err != nil {
+				t.Fatal(err)
+			}
+			ids := []int{}
+			for _, debt := range debts {
+				ids = append(ids, debt.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.ids) || res.Header.Get("Link") != "" {
+				t.Errorf("unspected result, want: %v, got: %v, link: %q", tc.ids, ids, res.Header.Get("Link"))
+			}
+		})
+	}
+}
+
+func TestDebtsPagination(t *testing.T) {
+	srv := newDebtsServer(t)
+	defer srv.Close()
+
+	for _, sort := range []string{"id", "-id", "-amount", "reason"} {
+		t.Run(sort, func(t *testing.T) {
+			res, err := http.Get(fmt.Sprintf("%s/user-debts/7?sort=%s", srv.URL, sort))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []DebtDTO
+			if err := unmarshalResponse(res, &want); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []DebtDTO
+			next := fmt.Sprintf("%s/user-debts/7?sort=%s&limit=2", srv.URL, sort)
+			for pages := 0; next != ""; pages++ {
+				if pages == 3 {
+					t.Fatalf("unspected pages, want: 3, got more, next: %s", next)
+				}
+				res, err := http.Get(next)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var page []DebtDTO
+				if err := unmarshalResponse(res, &page); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, page...)
+				next = nextLink(res)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unspected result, want: %v, got: %v", want, got)
+			}
+		})
+	}
+}
+
+func TestDebtsBadQuery(t *testing.T) {
+	srv := newDebtsServer(t)
+	defer srv.Close()
+
+	cursor := newDebtCursor("amount", userDebts[0]).String()
+	for _, query := range []string{
+		"min_amount=abc",
+		"max_amount=1.234",
+		"sort=date",
+		"limit=0",
+		"limit=101",
+		"cursor=nope",
+		"cursor=" + cursor,
+	} {
+		res, err := http.Get(srv.URL + "/user-debts/7?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("unspected status for %s, want: %d, got: %d", query, http.StatusBadRequest, res.StatusCode)
+		}
+	}
+}
+
+func TestClientFollowsDebtCursors(t *testing.T) {
+	defaultDebts = newDebtStore()
+	defer func() { defaultDebts = newDebtStore() }()
+	var debts []DebtDTO
+	for i := 1; i <= 2*defaultDebtsLimit+1; i++ {
+		debts = append(debts, DebtDTO{ID: i, Reason: "fee", Amount: Money(i * 100)})
+	}
+	defaultDebts.Put(9, debts)
+
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+
+	for name, get := range map[string]func() (UserStatus, error){
+		"client": func() (UserStatus, error) { return NewClient(srv.URL).GetUserStatus(context.Background(), "9") },
+		"sync":   func() (UserStatus, error) { return GetUserStatusSync(srv.URL, "9") },
+	} {
+		status, err := get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(status.Debts, debts) {
+			t.Errorf("unspected %s debts, want: %d, got: %d", name, len(debts), len(status.Debts))
+		}
+	}
+}
+
+func TestDebtCursorRoundTrip(t *testing.T) {
+	want := newDebtCursor("-amount", userDebts[0])
+	got, err := parseDebtCursor(want.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("unspected result, want: %+v, got: %+v", want, got)
+	}
+	if b, _ := json.Marshal(got.debt()); string(b) != `{"id":5,"reason":"loan","amount":200.00}` {
+		t.Errorf("unspected debt, got: %s", b)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxResponseBytes caps how much of an upstream body is decoded, after
+	// decompression.
+	maxResponseBytes = 1 << 20
+	// snippetBytes is how much of a failed body is kept for the error.
+	snippetBytes = 256
+)
+
+var (
+	// ErrUnexpectedStatus is returned for non 2xx upstream responses.
+	ErrUnexpectedStatus = errors.New("unexpected status")
+	// ErrUnexpectedContentType is returned when the body is not JSON.
+	ErrUnexpectedContentType = errors.New("unexpected content type")
+	// ErrResponseTooLarge is returned when the body exceeds maxResponseBytes.
+	ErrResponseTooLarge = errors.New("response too large")
+	// ErrNoResponse is returned when there is no response to decode.
+	ErrNoResponse = errors.New("no response")
+)
+
+// ResponseError describes an upstream response that could not be decoded.
+type ResponseError struct {
+	Upstream string
+	Status   int
+	Snippet  string
+	Err      error
+}
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("%s: status %d: %v", e.Upstream, e.Status, e.Err)
+	if e.Snippet != "" {
+		msg += fmt.Sprintf(": body %q", e.Snippet)
+	}
+	return msg
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// unmarshalResponse streams the JSON body of r into b. It rejects unknown
+// fields, non JSON content types and bodies bigger than maxResponseBytes,
+// and decompresses gzip encoded bodies.
+func unmarshalResponse(r *http.Response, b interface{}) error {
+	if r == nil {
+		return ErrNoResponse
+	}
+	defer r.Body.Close()
+
+	snippet := &prefixBuffer{limit: snippetBytes}
+	fail := func(err error) error {
+		return &ResponseError{
+			Upstream: upstreamOf(r),
+			Status:   r.StatusCode,
+			Snippet:  strings.TrimSpace(snippet.String()),
+			Err:      err,
+		}
+	}
+
+	body := io.Reader(r.Body)
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return fail(err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+	limited := &io.LimitedReader{R: body, N: maxResponseBytes + 1}
+	body = io.TeeReader(limited, snippet)
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		io.Copy(io.Discard, io.LimitReader(body, snippetBytes))
+		return fail(ErrUnexpectedStatus)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		io.Copy(io.Discard, io.LimitReader(body, snippetBytes))
+		return fail(fmt.Errorf("%w %q", ErrUnexpectedContentType, r.Header.Get("Content-Type")))
+	}
+
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(b)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after JSON value")
+	}
+	if limited.N <= 0 {
+		return fail(ErrResponseTooLarge)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// upstreamOf names the endpoint that answered r, e.g. "balance".
+func upstreamOf(r *http.Response) string {
+	if r.Request == nil {
+		return "unknown"
+	}
+	return endpointOf(r.Request.URL)
+}
+
+// prefixBuffer keeps only the first limit bytes written to it.
+type prefixBuffer struct {
+	limit int
+	buf   []byte
+}
+
+func (p *prefixBuffer) Write(b []byte) (int, error) {
+	if room := p.limit - len(p.buf); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		p.buf = append(p.buf, b[:room]...)
+	}
+	return len(b), nil
+}
+
+func (p *prefixBuffer) String() string {
+	return string(p.buf)
+}
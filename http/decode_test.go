@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newJSONResponse(status int, contentType, encoding string, body []byte) *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/balance/2", nil)
+	header := http.Header{"Content-Type": {contentType}}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestUnmarshalResponse(t *testing.T) {
+	balance := `{"user_id":2,"amount":15.50}`
+
+	tt := []struct {
+		name     string
+		response *http.Response
+		err      error
+	}{
+		{
+			name:     "valid json",
+			response: newJSONResponse(200, "application/json; charset=utf-8", "", []byte(balance)),
+		},
+		{
+			name:     "gzip body",
+			response: newJSONResponse(200, "application/json", "gzip", gzipped(balance)),
+		},
+		{
+			name:     "server error",
+			response: newJSONResponse(503, "text/plain", "", []byte("upstream unavailable")),
+			err:      ErrUnexpectedStatus,
+		},
+		{
+			name:     "html body",
+			response: newJSONResponse(200, "text/html", "", []byte("<html></html>")),
+			err:      ErrUnexpectedContentType,
+		},
+		{
+			name:     "too large",
+			response: newJSONResponse(200, "application/json", "", []byte(`{"user_id":2,"amount":15.50`+strings.Repeat(" ", maxResponseBytes)+`}`)),
+			err:      ErrResponseTooLarge,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var result BalanceDTO
+			err := unmarshalResponse(tc.response, &result)
+
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("unspected error, want: %v, got: %v", tc.err, err)
+			}
+			if tc.err == nil && result.Amount != 1550 {
+				t.Errorf("unspected result, want: 15.50, got: %s", result.Amount)
+			}
+		})
+	}
+}
+
+func TestUnmarshalResponseError(t *testing.T) {
+	var result BalanceDTO
+	err := unmarshalResponse(newJSONResponse(503, "text/plain", "", []byte("upstream unavailable")), &result)
+
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) {
+		t.Fatalf("unspected error type, got: %T", err)
+	}
+	if respErr.Upstream != "balance" || respErr.Status != 503 || respErr.Snippet != "upstream unavailable" {
+		t.Errorf("unspected error, got: %+v", respErr)
+	}
+}
+
+func TestUnmarshalNoResponse(t *testing.T) {
+	var result BalanceDTO
+	if err := unmarshalResponse(nil, &result); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("unspected error, want: %v, got: %v", ErrNoResponse, err)
+	}
+}
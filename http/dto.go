@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UserDTO is the body of /users/{id}.
+type UserDTO struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// BalanceDTO is the body of /balance/{id}.
+type BalanceDTO struct {
+	UserID int   `json:"user_id"`
+	Amount Money `json:"amount"`
+}
+
+// DebtDTO is each element of the body of /user-debts/{id}.
+type DebtDTO struct {
+	ID     int    `json:"id"`
+	Reason string `json:"reason"`
+	Amount Money  `json:"amount"`
+}
+
+// Money is an amount in cents, so it never suffers float rounding. It is
+// encoded in JSON as a decimal number with two digits, e.g. 15.50.
+type Money int64
+
+// ParseMoney parses a decimal amount with at most two fractional digits.
+func ParseMoney(s string) (Money, error) {
+	digits := strings.TrimPrefix(s, "-")
+	units, cents, _ := strings.Cut(digits, ".")
+	if units == "" || len(cents) > 2 || !isDigits(units) || !isDigits(cents) {
+		return 0, fmt.Errorf("invalid money amount %q", s)
+	}
+	cents += strings.Repeat("0", 2-len(cents))
+	m, err := strconv.ParseInt(units+cents, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid money amount %q: %w", s, err)
+	}
+	if digits != s {
+		m = -m
+	}
+	return Money(m), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats m as a decimal amount, e.g. -15.50.
+func (m Money) String() string {
+	sign, cents := "", int64(m)
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON encodes m as a JSON number.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number, rejecting strings and amounts with
+// more than two fractional digits.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	if bytes.HasPrefix(b, []byte(`"`)) {
+		return fmt.Errorf("money amount must be a number, got %s", b)
+	}
+	parsed, err := ParseMoney(string(b))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+
+	tt := []struct {
+		amount string
+		result Money
+		valid  bool
+	}{
+		{amount: "71", result: 7100, valid: true},
+		{amount: "15.5", result: 1550, valid: true},
+		{amount: "-0.07", result: -7, valid: true},
+		{amount: "1.234", valid: false},
+		{amount: "12,5", valid: false},
+		{amount: "", valid: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.amount, func(t *testing.T) {
+			result, err := ParseMoney(tc.amount)
+
+			if (err == nil) != tc.valid || result != tc.result {
+				t.Errorf("unspected result, want: %s (valid %t), got: %s (%v)", tc.result, tc.valid, result, err)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(DebtDTO{ID: 14, Reason: "chargeback", Amount: 1550})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":14,"reason":"chargeback","amount":15.50}`
+	if string(b) != want {
+		t.Errorf("unspected result, want: %s, got: %s", want, b)
+	}
+
+	var debt DebtDTO
+	if err := json.Unmarshal([]byte(`{"id":14,"amount":"15.50"}`), &debt); err == nil {
+		t.Errorf("money encoded as string must be rejected")
+	}
+}
+
+func TestUnmarshalResponseRejectsUnknownFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":2,"nmae":"user2"}`)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/users/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user UserDTO
+	if err := unmarshalResponse(resp, &user); err == nil {
+		t.Errorf("unknown field must be rejected")
+	}
+}
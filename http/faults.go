@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// faultPlanHeader lets a single request of an admin carry its own fault
+// plan as JSON.
+const faultPlanHeader = "X-Fault-Plan"
+
+// dripChunk is how many bytes are written at a time when slow dripping.
+const dripChunk = 8
+
+// FaultInjector keeps the fault plan of each route and applies it to the
+// requests served by its middleware.
+type FaultInjector struct {
+	admin bool
+
+	mu       sync.RWMutex
+	defaults map[string]RouteConfig
+	plans    map[string]RouteConfig
+}
+
+// NewFaultInjector starts with the plans given in the config routes. When
+// admin is true plans may be changed at runtime by the admin endpoint and
+// the X-Fault-Plan header of admin principals.
+func NewFaultInjector(routes map[string]RouteConfig, admin bool) *FaultInjector {
+	f := &FaultInjector{
+		admin:    admin,
+		defaults: map[string]RouteConfig{},
+		plans:    map[string]RouteConfig{},
+	}
+	for route, rc := range routes {
+		f.defaults[route] = rc
+		f.plans[route] = rc
+	}
+	return f
+}
+
+// Plan returns the current fault plan of route.
+func (f *FaultInjector) Plan(route string) RouteConfig {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.plans[route]
+}
+
+// SetPlan replaces the fault plan of route.
+func (f *FaultInjector) SetPlan(route string, rc RouteConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.plans[route] = rc
+}
+
+// ResetPlan goes back to the plan route had in the config.
+func (f *FaultInjector) ResetPlan(route string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rc, ok := f.defaults[route]; ok {
+		f.plans[route] = rc
+	} else {
+		delete(f.plans, route)
+	}
+}
+
+// Middleware returns a decorator that makes h misbehave following the
+// plan of route.
+func (f *FaultInjector) Middleware(route string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			plan := f.Plan(route)
+			principal, _ := PrincipalFrom(r.Context())
+			if raw := r.Header.Get(faultPlanHeader); raw != "" && f.admin && principal.HasRole(roleAdmin) {
+				var override RouteConfig
+				if err := json.Unmarshal([]byte(raw), &override); err != nil {
+					problem.Write(w, r, problem.BadRequest("invalid %s: %w", faultPlanHeader, err))
+					return
+				}
+				if err := override.validate(); err != nil {
+					problem.Write(w, r, problem.BadRequest("invalid %s: %w", faultPlanHeader, err))
+					return
+				}
+				plan = override
+			}
+
+			// delay
+			select {
+			case <-time.After(plan.Latency.Sample()):
+			case <-r.Context().Done():
+				return
+			}
+
+			if chance(plan.DropRate) {
+				// aborts the connection without writing a response.
+				panic(http.ErrAbortHandler)
+			}
+			if chance(plan.ErrorRate) {
+				code := http.StatusInternalServerError
+				if len(plan.ErrorCodes) > 0 {
+					code = plan.ErrorCodes[rand.Intn(len(plan.ErrorCodes))]
+				}
+				problem.Write(w, r, problem.New(code, "injected error"))
+				return
+			}
+
+			truncate := chance(plan.TruncateRate)
+			if !truncate && plan.SlowDrip == 0 {
+				h(w, r)
+				return
+			}
+
+			buffered := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+			h(buffered, r)
+			body := buffered.body.Bytes()
+			if truncate {
+				body = body[:len(body)/2]
+			}
+			w.Header().Del("Content-Length")
+			w.WriteHeader(buffered.status)
+			if plan.SlowDrip == 0 {
+				w.Write(body)
+				return
+			}
+			drip(w, r, body, time.Duration(plan.SlowDrip))
+		}
+	}
+}
+
+// drip writes body a few bytes at a time, waiting interval between writes.
+func drip(w http.ResponseWriter, r *http.Request, body []byte, interval time.Duration) {
+	flusher, _ := w.(http.Flusher)
+	for len(body) > 0 {
+		n := dripChunk
+		if n > len(body) {
+			n = len(body)
+		}
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		body = body[n:]
+		select {
+		case <-time.After(interval):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func chance(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// bufferedWriter holds the response of a handler so it can be altered
+// before reaching the client.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// listPlans serves GET /admin/faults with every plan.
+func (f *FaultInjector) listPlans(w http.ResponseWriter, r *http.Request) error {
+	f.mu.RLock()
+	plans := make(map[string]RouteConfig, len(f.plans))
+	for route, rc := range f.plans {
+		plans[route] = rc
+	}
+	f.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plans)
+	return nil
+}
+
+// getPlan serves GET /admin/faults/{route} with the plan of route.
+func (f *FaultInjector) getPlan(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.Plan(r.PathValue("route")))
+	return nil
+}
+
+// putPlan serves PUT /admin/faults/{route}, replacing the plan of route.
+func (f *FaultInjector) putPlan(w http.ResponseWriter, r *http.Request) error {
+	var rc RouteConfig
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rc); err != nil {
+		return problem.Wrap(http.StatusBadRequest, err)
+	}
+	if err := rc.validate(); err != nil {
+		return problem.Wrap(http.StatusBadRequest, err)
+	}
+	f.SetPlan(r.PathValue("route"), rc)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// deletePlan serves DELETE /admin/faults/{route}, back to the configured
+// plan of route.
+func (f *FaultInjector) deletePlan(w http.ResponseWriter, r *http.Request) error {
+	f.ResetPlan(r.PathValue("route"))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withFaultPlan sends plan as X-Fault-Plan on every request of the client.
+func withFaultPlan(plan string) ClientOption {
+	return func(c *Client) {
+		next := c.fetch
+		c.fetch = func(req *http.Request) (*http.Response, error) {
+			req.Header.Set(faultPlanHeader, plan)
+			return next(req)
+		}
+	}
+}
+
+func newFaultyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	cfg := demoConfig()
+	for route := range cfg.Routes {
+		cfg.Routes[route] = RouteConfig{}
+	}
+	cfg.FaultAdmin = true
+	return httptest.NewServer(newHandler(cfg))
+}
+
+func TestClientUnderFaults(t *testing.T) {
+	srv := newFaultyServer(t)
+	defer srv.Close()
+
+	tt := []struct {
+		name  string
+		plan  string
+		check func(error) bool
+	}{
+		{
+			name:  "random 5xx",
+			plan:  `{"error_rate": 1, "error_codes": [502, 503]}`,
+			check: func(err error) bool { return errors.Is(err, ErrUnexpectedStatus) },
+		},
+		{
+			name:  "dropped connection",
+			plan:  `{"drop_rate": 1}`,
+			check: func(err error) bool { return err != nil },
+		},
+		{
+			name: "truncated json",
+			plan: `{"truncate_rate": 1}`,
+			check: func(err error) bool {
+				var respErr *ResponseError
+				return errors.As(err, &respErr) && respErr.Status == http.StatusOK
+			},
+		},
+		{
+			name:  "slow drip",
+			plan:  `{"slow_drip": "100ms"}`,
+			check: func(err error) bool { return errors.Is(err, context.DeadlineExceeded) },
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+			client := NewClient(srv.URL, withFaultPlan(tc.plan))
+
+			_, err := client.GetUserStatus(ctx, "2")
+
+			if !tc.check(err) {
+				t.Errorf("unspected error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestFaultAdminEndpoint(t *testing.T) {
+	srv := newFaultyServer(t)
+	defer srv.Close()
+
+	put, _ := http.NewRequest(http.MethodPut, srv.URL+"/admin/faults/balance", strings.NewReader(`{"error_rate": 1, "error_codes": [503]}`))
+	defaultCredentials()(put)
+	resp, err := http.DefaultClient.Do(put)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unspected status, want 204, got: %d", resp.StatusCode)
+	}
+
+	resp, err = authGet(context.Background(), srv.URL+"/balance/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unspected status, want 503, got: %d", resp.StatusCode)
+	}
+
+	del, _ := http.NewRequest(http.MethodDelete, srv.URL+"/admin/faults/balance", nil)
+	defaultCredentials()(del)
+	if resp, err = http.DefaultClient.Do(del); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = authGet(context.Background(), srv.URL+"/balance/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unspected status after reset, want 200, got: %d", resp.StatusCode)
+	}
+}
+
+func TestFaultAdminRequiresAdmin(t *testing.T) {
+	srv := newFaultyServer(t)
+	defer srv.Close()
+	user, err := NewAuthenticator(demoKeys()).IssueToken("2", []string{scopeBalanceRead}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name        string
+		credentials Credentials
+		status      int
+	}{
+		{name: "anonymous", credentials: func(*http.Request) {}, status: http.StatusUnauthorized},
+		{name: "not admin", credentials: BearerCredentials(user), status: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			put, _ := http.NewRequest(http.MethodPut, srv.URL+"/admin/faults/balance", strings.NewReader(`{"error_rate": 1, "error_codes": [503]}`))
+			tc.credentials(put)
+			resp, err := http.DefaultClient.Do(put)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("unspected status, want: %d, got: %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+
+	resp, err := authGet(context.Background(), srv.URL+"/balance/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unspected status, plan was applied, want 200, got: %d", resp.StatusCode)
+	}
+}
+
+func TestFaultHeaderIgnoredWithoutAdmin(t *testing.T) {
+	cfg := demoConfig()
+	cfg.Routes = nil
+	srv := httptest.NewServer(newHandler(cfg))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, withFaultPlan(`{"error_rate": 1}`))
+	if _, err := client.GetUserStatus(context.Background(), "2"); err != nil {
+		t.Errorf("unspected error, got: %v", err)
+	}
+}
+
+func TestFaultHeaderIgnoredForNonAdmins(t *testing.T) {
+	srv := newFaultyServer(t)
+	defer srv.Close()
+	user, err := NewAuthenticator(demoKeys()).IssueToken("2", []string{scopeBalanceRead}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/balance/2", nil)
+	BearerCredentials(user)(req)
+	req.Header.Set(faultPlanHeader, `{"error_rate": 1, "error_codes": [503]}`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unspected status, plan was applied, want 200, got: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// This file holds a small GraphQL engine, enough of the language for the
+// schema of graphql_schema.go: queries with variables, arguments, aliases
+// and nested selections. Fragments, directives, mutations and introspection
+// are not supported.
+
+// Limits of the queries accepted by the server.
+const (
+	maxQueryDepth      = 5
+	maxQueryComplexity = 1000
+)
+
+var (
+	errQueryTooDeep    = errors.New("query is too deep")
+	errQueryTooComplex = errors.New("query is too complex")
+)
+
+// gqlField is a field asked in a query.
+type gqlField struct {
+	Alias      string
+	Name       string
+	Args       map[string]any
+	Selections []*gqlField
+}
+
+// key is the name of the field in the response.
+func (f *gqlField) key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// gqlVariable is a $variable used as an argument value.
+type gqlVariable string
+
+// gqlOperation is a query of a GraphQL document.
+type gqlOperation struct {
+	Name       string
+	Defaults   map[string]any
+	Selections []*gqlField
+}
+
+// gqlParser is a recursive descent parser reading one token ahead.
+type gqlParser struct {
+	src string
+	pos int
+	tok gqlToken
+}
+
+// gqlToken kinds: 'n' name, 'i' int, 'f' float, 's' string, 'p' punctuator
+// and 0 at the end of the document.
+type gqlToken struct {
+	kind byte
+	text string
+}
+
+// parseQuery parses src and returns its operation called operationName, or
+// its only operation when operationName is empty.
+func parseQuery(src, operationName string) (*gqlOperation, error) {
+	p := &gqlParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var ops []*gqlOperation
+	for p.tok.kind != 0 {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+
+	switch {
+	case len(ops) == 0:
+		return nil, errors.New("no operation in query")
+	case operationName == "" && len(ops) > 1:
+		return nil, errors.New("operationName is required for documents with several operations")
+	case operationName == "":
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.Name == operationName {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", operationName)
+}
+
+func (p *gqlParser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = gqlToken{}
+		return nil
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.IndexByte("{}()[]:$!=@", c) >= 0:
+		p.pos++
+		p.tok = gqlToken{kind: 'p', text: string(c)}
+	case c == '.' && strings.HasPrefix(p.src[p.pos:], "..."):
+		return errors.New("fragments are not supported")
+	case c == '"':
+		for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '"'; p.pos++ {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		if p.pos >= len(p.src) {
+			return fmt.Errorf("unterminated string at %d", start)
+		}
+		p.pos++
+		var s string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+			return fmt.Errorf("invalid string at %d", start)
+		}
+		p.tok = gqlToken{kind: 's', text: s}
+	case c == '-' || isDigit(c):
+		kind := byte('i')
+		for p.pos++; p.pos < len(p.src); p.pos++ {
+			c := p.src[p.pos]
+			if c == '.' || c == 'e' || c == 'E' {
+				kind = 'f'
+			} else if !isDigit(c) && !((c == '+' || c == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+				break
+			}
+		}
+		p.tok = gqlToken{kind: kind, text: p.src[start:p.pos]}
+	case isNameChar(c) && !isDigit(c):
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = gqlToken{kind: 'n', text: p.src[start:p.pos]}
+	default:
+		return fmt.Errorf("unexpected character %q at %d", c, start)
+	}
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// is reports whether the current token is the punctuator punct.
+func (p *gqlParser) is(punct string) bool {
+	return p.tok.kind == 'p' && p.tok.text == punct
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.tok.kind == 0 {
+		return errors.New("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected %q at %d", p.tok.text, p.pos-len(p.tok.text))
+}
+
+func (p *gqlParser) expect(punct string) error {
+	if !p.is(punct) {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.tok.kind != 'n' {
+		return "", p.unexpected()
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{Defaults: map[string]any{}}
+	if !p.is("{") {
+		keyword, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if keyword != "query" {
+			return nil, fmt.Errorf("only queries are supported, got %s", keyword)
+		}
+		if p.tok.kind == 'n' {
+			op.Name, _ = p.name()
+		}
+		if err := p.variableDefinitions(op); err != nil {
+			return nil, err
+		}
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = selections
+	return op, nil
+}
+
+// variableDefinitions reads ($id: Int! = 1, ...) keeping the defaults. The
+// types are not checked, resolvers validate the values they get.
+func (p *gqlParser) variableDefinitions(op *gqlOperation) error {
+	if !p.is("(") {
+		return nil
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if p.is("=") {
+			if err := p.next(); err != nil {
+				return err
+			}
+			value, err := p.value(true)
+			if err != nil {
+				return err
+			}
+			op.Defaults[name] = value
+		}
+	}
+	return p.next()
+}
+
+func (p *gqlParser) typeRef() error {
+	if p.is("[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.is("!") {
+		return p.next()
+	}
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []*gqlField
+	for !p.is("}") {
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, p.unexpected()
+	}
+	return fields, p.next()
+}
+
+func (p *gqlParser) field() (*gqlField, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &gqlField{Name: name}
+	if p.is(":") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f.Alias = name
+		if f.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f.Args = map[string]any{}
+		for !p.is(")") {
+			arg, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if f.Args[arg], err = p.value(false); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("@") {
+		return nil, errors.New("directives are not supported")
+	}
+	if p.is("{") {
+		if f.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// value reads an argument value. Constant values, as variable defaults,
+// may not use variables.
+func (p *gqlParser) value(constant bool) (any, error) {
+	tok := p.tok
+	switch {
+	case p.is("$") && !constant:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return gqlVariable(name), err
+	case p.is("["):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.is("]") {
+			if p.tok.kind == 0 {
+				return nil, p.unexpected()
+			}
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.next()
+	case p.is("{"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		object := map[string]any{}
+		for !p.is("}") {
+			key, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[key], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.next()
+	case tok.kind == 'i':
+		n, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %s", tok.text)
+		}
+		return n, p.next()
+	case tok.kind == 'f':
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s", tok.text)
+		}
+		return f, p.next()
+	case tok.kind == 's':
+		return tok.text, p.next()
+	case tok.kind == 'n':
+		var v any
+		switch tok.text {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			// enum values are passed as strings.
+			v = tok.text
+		}
+		return v, p.next()
+	}
+	return nil, p.unexpected()
+}
+
+// bindVariables replaces the variables used in the arguments of fields by
+// their values.
+func bindVariables(fields []*gqlField, vars map[string]any) error {
+	var bind func(v any) (any, error)
+	bind = func(v any) (any, error) {
+		switch v := v.(type) {
+		case gqlVariable:
+			value, ok := vars[string(v)]
+			if !ok {
+				return nil, fmt.Errorf("variable $%s is not defined", v)
+			}
+			return value, nil
+		case []any:
+			for i := range v {
+				var err error
+				if v[i], err = bind(v[i]); err != nil {
+					return nil, err
+				}
+			}
+		case map[string]any:
+			for key := range v {
+				var err error
+				if v[key], err = bind(v[key]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return v, nil
+	}
+
+	for _, f := range fields {
+		for arg, v := range f.Args {
+			var err error
+			if f.Args[arg], err = bind(v); err != nil {
+				return err
+			}
+		}
+		if err := bindVariables(f.Selections, vars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gqlResolver resolves a field for every parent of a level at once, so the
+// fields of list items are loaded in a single batch. A value may be an
+// error to fail the field of that parent only.
+type gqlResolver func(ctx context.Context, parents []any, args map[string]any) ([]any, error)
+
+// gqlType is an object type of a schema.
+type gqlType struct {
+	Name   string
+	Fields map[string]*gqlFieldDef
+}
+
+// gqlFieldDef is a field of a gqlType.
+type gqlFieldDef struct {
+	// Type of the field, nil for scalars.
+	Type *gqlType
+	// List fields resolve a []any per parent.
+	List bool
+	// Required arguments of the field.
+	Required []string
+	// Size estimates the length of list fields to score query complexity.
+	Size    func(args map[string]any) int
+	Resolve gqlResolver
+}
+
+// checkSelections validates fields against t and returns their complexity:
+// one point per field, with the fields of list items counted once per
+// expected item.
+func checkSelections(t *gqlType, fields []*gqlField, depth int) (int, error) {
+	if depth > maxQueryDepth {
+		return 0, fmt.Errorf("%w, max depth is %d", errQueryTooDeep, maxQueryDepth)
+	}
+	complexity := 0
+	for _, f := range fields {
+		complexity++
+		if f.Name == "__typename" {
+			continue
+		}
+		def, ok := t.Fields[f.Name]
+		if !ok {
+			return 0, fmt.Errorf("unknown field %s on %s", f.Name, t.Name)
+		}
+		for _, arg := range def.Required {
+			if f.Args[arg] == nil {
+				return 0, fmt.Errorf("field %s requires argument %s", f.Name, arg)
+			}
+		}
+		if def.Type == nil {
+			if len(f.Selections) > 0 {
+				return 0, fmt.Errorf("field %s is a scalar and has no fields", f.Name)
+			}
+			continue
+		}
+		if len(f.Selections) == 0 {
+			return 0, fmt.Errorf("field %s of type %s needs a selection of fields", f.Name, def.Type.Name)
+		}
+		children, err := checkSelections(def.Type, f.Selections, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		size := 1
+		if def.Size != nil {
+			size = def.Size(f.Args)
+		}
+		complexity += size * children
+	}
+	return complexity, nil
+}
+
+// gqlError is an error of the response, with the path of the field that
+// failed when it happened while executing the query.
+type gqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// gqlObject is a resolved object. It keeps the fields in the order they
+// were asked, as GraphQL responses do.
+type gqlObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *gqlObject) set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// MarshalJSON encodes the fields of o in order.
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// gqlExecutor resolves a query level by level, so every field is resolved
+// with a single resolver call whatever the number of parents.
+type gqlExecutor struct {
+	errors []gqlError
+}
+
+func (e *gqlExecutor) fail(err error, path []any) {
+	e.errors = append(e.errors, gqlError{Message: err.Error(), Path: path})
+}
+
+// gqlPath returns parent followed by elems, without sharing parent.
+func gqlPath(parent []any, elems ...any) []any {
+	return append(append(make([]any, 0, len(parent)+len(elems)), parent...), elems...)
+}
+
+// resolve returns the selected fields of every parent, of type t.
+func (e *gqlExecutor) resolve(ctx context.Context, t *gqlType, parents []any, paths [][]any, fields []*gqlField) []*gqlObject {
+	objects := make([]*gqlObject, len(parents))
+	for i := range objects {
+		objects[i] = &gqlObject{values: map[string]any{}}
+	}
+	if len(parents) == 0 {
+		return objects
+	}
+
+	for _, f := range fields {
+		key := f.key()
+		if f.Name == "__typename" {
+			for _, o := range objects {
+				o.set(key, t.Name)
+			}
+			continue
+		}
+		def := t.Fields[f.Name]
+		values, err := def.Resolve(ctx, parents, f.Args)
+		if err != nil {
+			for i, o := range objects {
+				o.set(key, nil)
+				e.fail(err, gqlPath(paths[i], key))
+			}
+			continue
+		}
+
+		// the objects of every parent are resolved together.
+		type slot struct{ parent, index int }
+		var children []any
+		var childPaths [][]any
+		var slots []slot
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				objects[i].set(key, nil)
+			case error:
+				objects[i].set(key, nil)
+				e.fail(v, gqlPath(paths[i], key))
+			default:
+				if def.Type == nil {
+					objects[i].set(key, v)
+					continue
+				}
+				if !def.List {
+					children = append(children, v)
+					childPaths = append(childPaths, gqlPath(paths[i], key))
+					slots = append(slots, slot{parent: i, index: -1})
+					continue
+				}
+				items := v.([]any)
+				objects[i].set(key, make([]any, len(items)))
+				for j, item := range items {
+					children = append(children, item)
+					childPaths = append(childPaths, gqlPath(paths[i], key, j))
+					slots = append(slots, slot{parent: i, index: j})
+				}
+			}
+		}
+		if def.Type == nil {
+			continue
+		}
+		resolved := e.resolve(ctx, def.Type, children, childPaths, f.Selections)
+		for k, s := range slots {
+			if s.index < 0 {
+				objects[s.parent].set(key, resolved[k])
+			} else {
+				objects[s.parent].values[key].([]any)[s.index] = resolved[k]
+			}
+		}
+	}
+	return objects
+}
+
+// graphqlRequest is the JSON body of a POST, or the query params of a GET.
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlResponse has no data when the request could not be executed.
+type graphqlResponse struct {
+	Data   *gqlObject `json:"data,omitempty"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// executeGraphQL runs the query of req against the query type.
+func executeGraphQL(ctx context.Context, query *gqlType, req graphqlRequest) (graphqlResponse, error) {
+	op, err := parseQuery(req.Query, req.OperationName)
+	if err != nil {
+		return graphqlResponse{}, err
+	}
+	vars := map[string]any{}
+	for name, v := range op.Defaults {
+		vars[name] = v
+	}
+	for name, v := range req.Variables {
+		vars[name] = v
+	}
+	if err := bindVariables(op.Selections, vars); err != nil {
+		return graphqlResponse{}, err
+	}
+	complexity, err := checkSelections(query, op.Selections, 1)
+	if err != nil {
+		return graphqlResponse{}, err
+	}
+	if complexity > maxQueryComplexity {
+		return graphqlResponse{}, fmt.Errorf("%w, complexity %d is over %d", errQueryTooComplex, complexity, maxQueryComplexity)
+	}
+
+	e := &gqlExecutor{}
+	data := e.resolve(ctx, query, []any{nil}, [][]any{nil}, op.Selections)
+	return graphqlResponse{Data: data[0], Errors: e.errors}, nil
+}
+
+// serveGraphQL answers GraphQL requests over HTTP. Requests that can't be
+// executed get a 400 with GraphQL errors, while errors of single fields are
+// reported next to the data of the others. Only the errors of HTTP itself,
+// such as the method, are returned.
+func serveGraphQL(w http.ResponseWriter, r *http.Request, query *gqlType) error {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeGraphQL(w, http.StatusBadRequest, graphqlResponse{Errors: []gqlError{{Message: "invalid variables: " + err.Error()}}})
+				return nil
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeGraphQL(w, http.StatusBadRequest, graphqlResponse{Errors: []gqlError{{Message: "invalid request: " + err.Error()}}})
+			return nil
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return problem.MethodNotAllowed(r.Method)
+	}
+
+	resp, err := executeGraphQL(r.Context(), query, req)
+	if err != nil {
+		writeGraphQL(w, http.StatusBadRequest, graphqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return nil
+	}
+	writeGraphQL(w, http.StatusOK, resp)
+	return nil
+}
+
+func writeGraphQL(w http.ResponseWriter, status int, resp graphqlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
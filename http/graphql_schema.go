@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// batchLoader loads values by key, a whole batch per fetch, and caches them
+// for the life of the loader so fields sharing data fetch it once. It is
+// not safe for concurrent use, the executor resolves one field at a time.
+type batchLoader[K comparable, V any] struct {
+	fetch   func(ctx context.Context, keys []K) (map[K]V, error)
+	cache   map[K]V
+	fetches int
+}
+
+func newBatchLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{fetch: fetch, cache: map[K]V{}}
+}
+
+// loadMany returns the values of keys, fetching the ones not cached yet in
+// a single call.
+func (l *batchLoader[K, V]) loadMany(ctx context.Context, keys []K) (map[K]V, error) {
+	var missing []K
+	seen := map[K]bool{}
+	for _, k := range keys {
+		if _, ok := l.cache[k]; !ok && !seen[k] {
+			seen[k] = true
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		l.fetches++
+		values, err := l.fetch(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range values {
+			l.cache[k] = v
+		}
+	}
+
+	values := make(map[K]V, len(keys))
+	for _, k := range keys {
+		values[k] = l.cache[k]
+	}
+	return values, nil
+}
+
+// sectionLoader fetches a batch of users with find, paying the latency of
+// route once per batch as the batch endpoints do.
+func sectionLoader[V any](faults *FaultInjector, route string, timeout Duration, find func(int) V) func(context.Context, []int) (map[int]V, error) {
+	return func(ctx context.Context, ids []int) (map[int]V, error) {
+		result := <-fetchSection(ctx, faults, route, time.Duration(timeout), func() map[int]V {
+			values := make(map[int]V, len(ids))
+			for _, id := range ids {
+				values[id] = find(id)
+			}
+			return values
+		})
+		return result.value, result.err
+	}
+}
+
+// graphqlLoaders load the data of a single GraphQL request.
+type graphqlLoaders struct {
+	users    *batchLoader[int, UserDTO]
+	balances *batchLoader[int, BalanceDTO]
+	debts    *batchLoader[int, []DebtDTO]
+}
+
+func newGraphQLLoaders(faults *FaultInjector, timeouts map[string]Duration) *graphqlLoaders {
+	return &graphqlLoaders{
+		users:    newBatchLoader(sectionLoader(faults, "users", timeouts["users"], findUser)),
+		balances: newBatchLoader(sectionLoader(faults, "balance", timeouts["balance"], findBalance)),
+		debts:    newBatchLoader(sectionLoader(faults, "user-debts", timeouts["user-debts"], findDebts)),
+	}
+}
+
+// graphqlHandler serves /graphql with fresh loaders for every request.
+func graphqlHandler(faults *FaultInjector, timeouts map[string]Duration) problem.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return serveGraphQL(w, r, newGraphQLSchema(newGraphQLLoaders(faults, timeouts)))
+	}
+}
+
+// newGraphQLSchema returns the query type of the schema:
+//
+//	type Query {
+//	  user(id: Int!): User
+//	  users(ids: [Int!]!): [User!]!
+//	}
+//	type User {
+//	  id: Int!
+//	  name: String!
+//	  balance: Balance
+//	  debts: [Debt!]
+//	  debtTotal: Float
+//	}
+//	type Balance { userId: Int!, amount: Float! }
+//	type Debt { id: Int!, reason: String!, amount: Float! }
+//
+// Fields are authorized as the routes serving the same data are.
+func newGraphQLSchema(l *graphqlLoaders) *gqlType {
+	balance := &gqlType{Name: "Balance", Fields: map[string]*gqlFieldDef{
+		"userId": {Resolve: property(func(b BalanceDTO) any { return b.UserID })},
+		"amount": {Resolve: property(func(b BalanceDTO) any { return b.Amount })},
+	}}
+	debt := &gqlType{Name: "Debt", Fields: map[string]*gqlFieldDef{
+		"id":     {Resolve: property(func(d DebtDTO) any { return d.ID })},
+		"reason": {Resolve: property(func(d DebtDTO) any { return d.Reason })},
+		"amount": {Resolve: property(func(d DebtDTO) any { return d.Amount })},
+	}}
+	user := &gqlType{Name: "User", Fields: map[string]*gqlFieldDef{
+		"id":      {Resolve: property(func(u UserDTO) any { return u.ID })},
+		"name":    {Resolve: property(func(u UserDTO) any { return u.Name })},
+		"balance": {Type: balance, Resolve: userField("balance", scopeBalanceRead, l.balances, func(b BalanceDTO) any { return b })},
+		"debts": {Type: debt, List: true, Size: fixedSize(10), Resolve: userField("user-debts", scopeDebtsRead, l.debts, func(debts []DebtDTO) any {
+			items := make([]any, len(debts))
+			for i, d := range debts {
+				items[i] = d
+			}
+			return items
+		})},
+		"debtTotal": {Resolve: userField("user-debts", scopeDebtsRead, l.debts, func(debts []DebtDTO) any {
+			var total Money
+			for _, d := range debts {
+				total += d.Amount
+			}
+			return total
+		})},
+	}}
+
+	return &gqlType{Name: "Query", Fields: map[string]*gqlFieldDef{
+		"user": {Type: user, Required: []string{"id"}, Resolve: func(ctx context.Context, _ []any, args map[string]any) ([]any, error) {
+			id, err := intArg(args["id"])
+			if err != nil {
+				return nil, fmt.Errorf("id: %w", err)
+			}
+			users, err := loadUsers(ctx, l, []int{id})
+			if err != nil {
+				return nil, err
+			}
+			return []any{users[0]}, nil
+		}},
+		"users": {Type: user, List: true, Required: []string{"ids"}, Size: listSize("ids"), Resolve: func(ctx context.Context, _ []any, args map[string]any) ([]any, error) {
+			raw, _ := args["ids"].([]any)
+			if len(raw) > maxBatchIDs {
+				return nil, fmt.Errorf("ids must list at most %d user IDs", maxBatchIDs)
+			}
+			ids := make([]int, len(raw))
+			for i, v := range raw {
+				var err error
+				if ids[i], err = intArg(v); err != nil {
+					return nil, fmt.Errorf("ids: %w", err)
+				}
+			}
+			users, err := loadUsers(ctx, l, ids)
+			if err != nil {
+				return nil, err
+			}
+			return []any{users}, nil
+		}},
+	}}
+}
+
+// loadUsers returns the users of ids, in order, when the principal may
+// read all of them.
+func loadUsers(ctx context.Context, l *graphqlLoaders, ids []int) ([]any, error) {
+	for _, id := range ids {
+		if err := allow(ctx, "users", scopeUsersRead, id); err != nil {
+			return nil, err
+		}
+	}
+	loaded, err := l.users.loadMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]any, len(ids))
+	for i, id := range ids {
+		users[i] = loaded[id]
+	}
+	return users, nil
+}
+
+// property resolves a scalar field of parents of type T.
+func property[T any](get func(T) any) gqlResolver {
+	return func(_ context.Context, parents []any, _ map[string]any) ([]any, error) {
+		values := make([]any, len(parents))
+		for i, p := range parents {
+			values[i] = get(p.(T))
+		}
+		return values, nil
+	}
+}
+
+// userField resolves a field of User from loader, in a single batch for
+// every user the principal may read on route.
+func userField[V any](route, scope string, loader *batchLoader[int, V], value func(V) any) gqlResolver {
+	return func(ctx context.Context, parents []any, _ map[string]any) ([]any, error) {
+		values := make([]any, len(parents))
+		var ids []int
+		for i, p := range parents {
+			id := p.(UserDTO).ID
+			if err := allow(ctx, route, scope, id); err != nil {
+				values[i] = err
+				continue
+			}
+			ids = append(ids, id)
+		}
+		loaded, err := loader.loadMany(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range parents {
+			if values[i] == nil {
+				values[i] = value(loaded[p.(UserDTO).ID])
+			}
+		}
+		return values, nil
+	}
+}
+
+func fixedSize(n int) func(map[string]any) int {
+	return func(map[string]any) int { return n }
+}
+
+// listSize estimates a list field returns as many items as its arg lists.
+func listSize(arg string) func(map[string]any) int {
+	return func(args map[string]any) int {
+		list, _ := args[arg].([]any)
+		return len(list)
+	}
+}
+
+// intArg reads an Int argument, either from the query or from JSON
+// variables, which decode numbers as float64.
+func intArg(v any) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not an Int", v)
+}
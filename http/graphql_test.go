@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newGraphQLTest returns loaders with no latency and a context of principal.
+func newGraphQLTest(principal Principal) (context.Context, *graphqlLoaders) {
+	return withPrincipal(context.Background(), principal), newGraphQLLoaders(NewFaultInjector(nil, false), nil)
+}
+
+var adminPrincipal = Principal{
+	Subject: "admin",
+	Scopes:  []string{scopeUsersRead, scopeBalanceRead, scopeDebtsRead},
+	Roles:   []string{roleAdmin},
+}
+
+func TestParseQuery(t *testing.T) {
+	tt := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{name: "shorthand", query: `{ user(id: 2) { name } }`},
+		{name: "named with variables", query: `query Status($id: Int! = 2, $ids: [Int!]) { a: user(id: $id) { name } users(ids: $ids) { id } }`},
+		{name: "comments and commas", query: "{\n  # the user\n  user(id: 2) { id, name }\n}"},
+		{name: "fragments", query: `{ user(id: 2) { ...UserFields } }`, err: "fragments are not supported"},
+		{name: "mutation", query: `mutation { pay(id: 2) { id } }`, err: "only queries are supported"},
+		{name: "unterminated string", query: `{ user(id: "2) { id } }`, err: "unterminated string"},
+		{name: "unclosed selection", query: `{ user(id: 2) { id }`, err: "unexpected end of query"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseQuery(tc.query, "")
+
+			if tc.err == "" && err != nil {
+				t.Errorf("unspected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("unspected error, want: %s, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestGraphQLBatchesUsers(t *testing.T) {
+	ctx, loaders := newGraphQLTest(adminPrincipal)
+
+	resp, err := executeGraphQL(ctx, newGraphQLSchema(loaders), graphqlRequest{
+		Query:     `query($ids: [Int!]!) { users(ids: $ids) { name debtTotal balance { amount } debts { reason } } }`,
+		Variables: map[string]any{"ids": []any{1.0, 2.0, 3.0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unspected errors: %+v", resp.Errors)
+	}
+
+	users := resp.Data.values["users"].([]any)
+	if len(users) != 3 || users[1].(*gqlObject).values["name"] != "user2" {
+		t.Errorf("unspected users, got: %+v", users)
+	}
+	if total := users[0].(*gqlObject).values["debtTotal"]; total != Money(12950) {
+		t.Errorf("unspected debt total, want: 129.50, got: %v", total)
+	}
+	// one fetch per loader for the three users, debts shared by two fields.
+	for name, fetches := range map[string]int{"users": loaders.users.fetches, "balances": loaders.balances.fetches, "debts": loaders.debts.fetches} {
+		if fetches != 1 {
+			t.Errorf("unspected %s fetches, want: 1, got: %d", name, fetches)
+		}
+	}
+}
+
+func TestGraphQLFieldOrder(t *testing.T) {
+	ctx, loaders := newGraphQLTest(adminPrincipal)
+
+	resp, err := executeGraphQL(ctx, newGraphQLSchema(loaders), graphqlRequest{Query: `{ user(id: 2) { name id __typename } }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(resp)
+
+	want := `{"data":{"user":{"name":"user2","id":2,"__typename":"User"}}}`
+	if string(b) != want {
+		t.Errorf("unspected response, want: %s, got: %s", want, b)
+	}
+}
+
+func TestGraphQLFieldAuthorization(t *testing.T) {
+	ctx, loaders := newGraphQLTest(Principal{Subject: "2", Scopes: []string{scopeUsersRead, scopeBalanceRead}})
+
+	resp, err := executeGraphQL(ctx, newGraphQLSchema(loaders), graphqlRequest{
+		Query: `{ users(ids: [2, 3]) { name balance { amount } debtTotal } }`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := resp.Data.values["users"].([]any)
+	if users[1].(*gqlObject).values["name"] != "user3" {
+		t.Errorf("unspected name of user 3, got: %v", users[1].(*gqlObject).values["name"])
+	}
+	if users[0].(*gqlObject).values["balance"] == nil || users[1].(*gqlObject).values["balance"] != nil {
+		t.Errorf("unspected balances, want only the own one, got: %v %v", users[0].(*gqlObject).values["balance"], users[1].(*gqlObject).values["balance"])
+	}
+	// one balance denied, plus debtTotal of both users for lack of scope.
+	if len(resp.Errors) != 3 {
+		t.Fatalf("unspected errors, want: 3, got: %+v", resp.Errors)
+	}
+	path, _ := json.Marshal(resp.Errors[0].Path)
+	if string(path) != `["users",1,"balance"]` {
+		t.Errorf("unspected error path, got: %s", path)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	ctx, loaders := newGraphQLTest(adminPrincipal)
+	ids := strings.Repeat("1,", maxBatchIDs)
+
+	tt := []struct {
+		name  string
+		query string
+		err   error
+	}{
+		{name: "within limits", query: `{ user(id: 1) { balance { amount } } }`},
+		{name: "too complex", query: `{ users(ids: [` + ids + `]) { id name debtTotal debts { id reason amount } } }`, err: errQueryTooComplex},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := executeGraphQL(ctx, newGraphQLSchema(loaders), graphqlRequest{Query: tc.query})
+
+			if !errors.Is(err, tc.err) {
+				t.Errorf("unspected error, want: %v, got: %v", tc.err, err)
+			}
+		})
+	}
+
+	deep := &gqlType{Name: "Node", Fields: map[string]*gqlFieldDef{}}
+	deep.Fields["next"] = &gqlFieldDef{Type: deep}
+	deep.Fields["id"] = &gqlFieldDef{}
+	op, _ := parseQuery(`{ next { next { next { next { next { id } } } } } }`, "")
+	if _, err := checkSelections(deep, op.Selections, 1); !errors.Is(err, errQueryTooDeep) {
+		t.Errorf("unspected error, want: %v, got: %v", errQueryTooDeep, err)
+	}
+}
+
+func TestGraphQLEndpoint(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+
+	tt := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{name: "valid query", query: `{ user(id: 2) { name debtTotal } }`, status: http.StatusOK},
+		{name: "unknown field", query: `{ user(id: 2) { email } }`, status: http.StatusBadRequest},
+		{name: "missing argument", query: `{ user { name } }`, status: http.StatusBadRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(graphqlRequest{Query: tc.query})
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/graphql", bytes.NewReader(body))
+			defaultCredentials()(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var result graphqlResponse
+			json.NewDecoder(resp.Body).Decode(&result)
+
+			if resp.StatusCode != tc.status {
+				t.Errorf("unspected status, want: %d, got: %d %+v", tc.status, resp.StatusCode, result.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jegutierrez/functional_patterns_go/http/userstatuspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// grpcCredentials sends Credentials as gRPC metadata, with the headers they
+// would set on an HTTP request.
+type grpcCredentials Credentials
+
+func (c grpcCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	req := &http.Request{Header: http.Header{}}
+	c(req)
+	md := make(map[string]string, len(req.Header))
+	for key := range req.Header {
+		md[strings.ToLower(key)] = req.Header.Get(key)
+	}
+	return md, nil
+}
+
+func (grpcCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// DialGRPC connects to the gRPC server at target over transport, e.g.
+// credentials.NewClientTLSFromFile for servers with TLS or
+// insecure.NewCredentials() for plaintext ones, authenticating with creds,
+// or the default credentials when nil.
+func DialGRPC(target string, transport credentials.TransportCredentials, creds Credentials, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if creds == nil {
+		creds = defaultCredentials()
+	}
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(transport),
+		grpc.WithPerRPCCredentials(grpcCredentials(creds)),
+	}, opts...)
+	return grpc.NewClient(target, opts...)
+}
+
+// GRPCClient is the gRPC flavor of Client.
+type GRPCClient struct {
+	rpc userstatuspb.UserStatusServiceClient
+}
+
+// NewGRPCClient calls the user status service over conn.
+func NewGRPCClient(conn grpc.ClientConnInterface) *GRPCClient {
+	return &GRPCClient{rpc: userstatuspb.NewUserStatusServiceClient(conn)}
+}
+
+// GetUserStatus calls the three methods concurrently and joins user's data.
+func (c *GRPCClient) GetUserStatus(ctx context.Context, userID string) (UserStatus, error) {
+	req, err := userRequest(userID)
+	if err != nil {
+		return UserStatus{}, err
+	}
+
+	type result[T any] struct {
+		value T
+		err   error
+	}
+	userCall := make(chan result[*userstatuspb.User], 1)
+	balanceCall := make(chan result[*userstatuspb.Balance], 1)
+	debtsCall := make(chan result[[]DebtDTO], 1)
+	go func() {
+		user, err := c.rpc.GetUser(ctx, req)
+		userCall <- result[*userstatuspb.User]{user, err}
+	}()
+	go func() {
+		balance, err := c.rpc.GetBalance(ctx, req)
+		balanceCall <- result[*userstatuspb.Balance]{balance, err}
+	}()
+	go func() {
+		debts, err := c.listDebts(ctx, req)
+		debtsCall <- result[[]DebtDTO]{debts, err}
+	}()
+	user, balance, debts := <-userCall, <-balanceCall, <-debtsCall
+
+	if err := errors.Join(user.err, balance.err, debts.err); err != nil {
+		return UserStatus{}, err
+	}
+	return newUserStatus(
+		UserDTO{ID: int(user.value.GetId()), Name: user.value.GetName()},
+		BalanceDTO{UserID: int(balance.value.GetUserId()), Amount: Money(balance.value.GetAmountCents())},
+		debts.value,
+	), nil
+}
+
+// GetUserStatusAggregated asks the server to join user's data, in a single
+// call.
+func (c *GRPCClient) GetUserStatusAggregated(ctx context.Context, userID string) (UserStatus, error) {
+	req, err := userRequest(userID)
+	if err != nil {
+		return UserStatus{}, err
+	}
+	status, err := c.rpc.GetUserStatus(ctx, req)
+	if err != nil {
+		return UserStatus{}, err
+	}
+	debts := make([]DebtDTO, len(status.GetDebts()))
+	for i, debt := range status.GetDebts() {
+		debts[i] = debtFromProto(debt)
+	}
+	return UserStatus{
+		ID:            int(status.GetId()),
+		Name:          status.GetName(),
+		BalanceAmount: Money(status.GetBalanceAmountCents()),
+		Debts:         debts,
+	}, nil
+}
+
+// listDebts reads the debts streamed by the server until it is done.
+func (c *GRPCClient) listDebts(ctx context.Context, req *userstatuspb.UserRequest) ([]DebtDTO, error) {
+	stream, err := c.rpc.ListDebts(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	debts := []DebtDTO{}
+	for {
+		debt, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return debts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		debts = append(debts, debtFromProto(debt))
+	}
+}
+
+func userRequest(userID string) (*userstatuspb.UserRequest, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &userstatuspb.UserRequest{UserId: id}, nil
+}
+
+func debtFromProto(debt *userstatuspb.Debt) DebtDTO {
+	return DebtDTO{ID: int(debt.GetId()), Reason: debt.GetReason(), Amount: Money(debt.GetAmountCents())}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/http/userstatuspb"
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer serves the same data as handler() over gRPC, with the latency
+// and errors of the configured routes.
+type grpcServer struct {
+	userstatuspb.UnimplementedUserStatusServiceServer
+	faults   *FaultInjector
+	timeouts map[string]Duration
+}
+
+// newGRPCServer authenticates calls with the credentials of cfg, sent as
+// the same authorization or x-api-key headers as over HTTP.
+func newGRPCServer(cfg Config) (*grpc.Server, error) {
+	auth := NewAuthenticator(cfg.Auth)
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, h grpc.UnaryHandler) (any, error) {
+			ctx, err := authenticateMetadata(ctx, auth)
+			if err != nil {
+				return nil, err
+			}
+			return h(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+			ctx, err := authenticateMetadata(ss.Context(), auth)
+			if err != nil {
+				return err
+			}
+			return h(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+		}),
+	}
+	if cfg.TLS.Enabled() {
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	s := grpc.NewServer(opts...)
+	userstatuspb.RegisterUserStatusServiceServer(s, &grpcServer{
+		faults:   NewFaultInjector(cfg.Routes, false),
+		timeouts: cfg.StatusTimeouts,
+	})
+	return s, nil
+}
+
+// serveGRPC adds the gRPC service of cfg to lc, stopping it gracefully on
+// shutdown and forcibly once the drain deadline passes.
+func serveGRPC(lc *lifecycle.Manager, cfg Config) error {
+	s, err := newGRPCServer(cfg)
+	if err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		return err
+	}
+	lc.Add("grpc "+cfg.GRPCAddr, func() error {
+		return s.Serve(lis)
+	}, func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			s.Stop()
+			return ctx.Err()
+		}
+	})
+	return nil
+}
+
+// authenticateMetadata returns ctx with the principal of the credentials in
+// its incoming metadata.
+func authenticateMetadata(ctx context.Context, auth *Authenticator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := &http.Request{Header: http.Header{}}
+	for _, key := range []string{"authorization", "x-api-key"} {
+		for _, v := range md.Get(key) {
+			r.Header.Add(key, v)
+		}
+	}
+	principal, err := auth.Authenticate(r)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return withPrincipal(ctx, principal), nil
+}
+
+// authenticatedStream carries the principal in the context of a stream.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcError maps the errors of a lookup to a gRPC status.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// allowGRPC is allow, answering PermissionDenied when the principal may not
+// read userID.
+func allowGRPC(ctx context.Context, route, scope string, userID int) error {
+	if err := allow(ctx, route, scope, userID); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+func (s *grpcServer) GetUser(ctx context.Context, req *userstatuspb.UserRequest) (*userstatuspb.User, error) {
+	userID := int(req.GetUserId())
+	if err := allowGRPC(ctx, "users", scopeUsersRead, userID); err != nil {
+		return nil, err
+	}
+	result := <-fetchSection(ctx, s.faults, "users", time.Duration(s.timeouts["users"]), func() UserDTO {
+		return findUser(userID)
+	})
+	if result.err != nil {
+		return nil, grpcError(result.err)
+	}
+	return userToProto(result.value), nil
+}
+
+func (s *grpcServer) GetBalance(ctx context.Context, req *userstatuspb.UserRequest) (*userstatuspb.Balance, error) {
+	userID := int(req.GetUserId())
+	if err := allowGRPC(ctx, "balance", scopeBalanceRead, userID); err != nil {
+		return nil, err
+	}
+	result := <-fetchSection(ctx, s.faults, "balance", time.Duration(s.timeouts["balance"]), func() BalanceDTO {
+		return findBalance(userID)
+	})
+	if result.err != nil {
+		return nil, grpcError(result.err)
+	}
+	return balanceToProto(result.value), nil
+}
+
+func (s *grpcServer) ListDebts(req *userstatuspb.UserRequest, stream grpc.ServerStreamingServer[userstatuspb.Debt]) error {
+	ctx := stream.Context()
+	userID := int(req.GetUserId())
+	if err := allowGRPC(ctx, "user-debts", scopeDebtsRead, userID); err != nil {
+		return err
+	}
+	result := <-fetchSection(ctx, s.faults, "user-debts", time.Duration(s.timeouts["user-debts"]), func() []DebtDTO {
+		return findDebts(userID)
+	})
+	if result.err != nil {
+		return grpcError(result.err)
+	}
+	for _, debt := range result.value {
+		if err := stream.Send(debtToProto(debt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *grpcServer) GetUserStatus(ctx context.Context, req *userstatuspb.UserRequest) (*userstatuspb.UserStatus, error) {
+	userID := int(req.GetUserId())
+	for _, scope := range []string{scopeUsersRead, scopeBalanceRead, scopeDebtsRead} {
+		if err := allowGRPC(ctx, "user-status", scope, userID); err != nil {
+			return nil, err
+		}
+	}
+	userStatus, err := lookupUserStatus(ctx, s.faults, s.timeouts, userID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return userStatusToProto(userStatus), nil
+}
+
+func userToProto(user UserDTO) *userstatuspb.User {
+	return &userstatuspb.User{Id: int64(user.ID), Name: user.Name}
+}
+
+func balanceToProto(balance BalanceDTO) *userstatuspb.Balance {
+	return &userstatuspb.Balance{UserId: int64(balance.UserID), AmountCents: int64(balance.Amount)}
+}
+
+func debtToProto(debt DebtDTO) *userstatuspb.Debt {
+	return &userstatuspb.Debt{Id: int64(debt.ID), Reason: debt.Reason, AmountCents: int64(debt.Amount)}
+}
+
+func userStatusToProto(s UserStatus) *userstatuspb.UserStatus {
+	debts := make([]*userstatuspb.Debt, len(s.Debts))
+	for i, debt := range s.Debts {
+		debts[i] = debtToProto(debt)
+	}
+	return &userstatuspb.UserStatus{
+		Id:                 int64(s.ID),
+		Name:               s.Name,
+		BalanceAmountCents: int64(s.BalanceAmount),
+		Debts:              debts,
+	}
+}
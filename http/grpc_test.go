@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCTestServer serves cfg over gRPC on a random port and returns a
+// plaintext connection to it authenticated with creds.
+func newGRPCTestServer(t testing.TB, cfg Config, creds Credentials) *grpc.ClientConn {
+	t.Helper()
+	return newGRPCTestServerOver(t, cfg, insecure.NewCredentials(), creds)
+}
+
+// newGRPCTestServerOver is newGRPCTestServer dialing over transport.
+func newGRPCTestServerOver(t testing.TB, cfg Config, transport credentials.TransportCredentials, creds Credentials) *grpc.ClientConn {
+	t.Helper()
+	srv, err := newGRPCServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := DialGRPC(lis.Addr().String(), transport, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// benchConfig is demoConfig without the demo delays nor rate limits.
+func benchConfig() Config {
+	cfg := demoConfig()
+	cfg.Routes = nil
+	cfg.RateLimits = nil
+	return cfg
+}
+
+func TestGRPCGetUserStatus(t *testing.T) {
+	client := NewGRPCClient(newGRPCTestServer(t, demoConfig(), nil))
+
+	for name, get := range map[string]func(context.Context, string) (UserStatus, error){
+		"fan-out":    client.GetUserStatus,
+		"aggregated": client.GetUserStatusAggregated,
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := get(context.Background(), "2")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.ID != 2 || result.Name != "user2" || len(result.Debts) != 3 || result.Debts[0].Amount != 7100 {
+				t.Errorf("unspected result, got: %+v", result)
+			}
+		})
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	auth := NewAuthenticator(demoKeys())
+	token, err := auth.IssueToken("2", []string{scopeUsersRead, scopeBalanceRead, scopeDebtsRead}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name   string
+		creds  Credentials
+		userID string
+		code   codes.Code
+	}{
+		{name: "own data", creds: BearerCredentials(token), userID: "2", code: codes.OK},
+		{name: "other user", creds: BearerCredentials(token), userID: "3", code: codes.PermissionDenied},
+		{name: "unknown key", creds: APIKeyCredentials("nope"), userID: "2", code: codes.Unauthenticated},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewGRPCClient(newGRPCTestServer(t, benchConfig(), tc.creds))
+
+			_, err := client.GetUserStatus(context.Background(), tc.userID)
+
+			if code := status.Code(err); code != tc.code {
+				t.Errorf("unspected code, want: %s, got: %s (%v)", tc.code, code, err)
+			}
+		})
+	}
+}
+
+func TestGRPCOverTLS(t *testing.T) {
+	// borrow the certificate httptest trusts for 127.0.0.1.
+	https := httptest.NewTLSServer(nil)
+	https.Close()
+	cert := https.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := demoConfig()
+	cfg.TLS = TLSConfig{CertFile: filepath.Join(t.TempDir(), "cert.pem"), KeyFile: filepath.Join(t.TempDir(), "key.pem")}
+	for file, block := range map[string]*pem.Block{
+		cfg.TLS.CertFile: {Type: "CERTIFICATE", Bytes: cert.Certificate[0]},
+		cfg.TLS.KeyFile:  {Type: "PRIVATE KEY", Bytes: key},
+	} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(https.Certificate())
+
+	client := NewGRPCClient(newGRPCTestServerOver(t, cfg, credentials.NewClientTLSFromCert(pool, ""), nil))
+	if result, err := client.GetUserStatus(context.Background(), "2"); err != nil || result.ID != 2 {
+		t.Errorf("unspected result, want user 2, got: %+v (%v)", result, err)
+	}
+}
+
+func BenchmarkGetUserStatusHTTP(b *testing.B) {
+	srv := httptest.NewServer(newHandler(benchConfig()))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	for i := 0; i < b.N; i++ {
+		if _, err := client.GetUserStatus(context.Background(), "2"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetUserStatusGRPC(b *testing.B) {
+	client := NewGRPCClient(newGRPCTestServer(b, benchConfig(), nil))
+
+	for i := 0; i < b.N; i++ {
+		if _, err := client.GetUserStatus(context.Background(), "2"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+)
+
+// storeRoutes are the routes backed by the simulated store.
+var storeRoutes = []string{"users", "balance", "user-debts"}
+
+// storeReads read a user from the store behind each of storeRoutes.
+var storeReads = map[string]func(userID int){
+	"users":      func(userID int) { findUser(userID) },
+	"balance":    func(userID int) { findBalance(userID) },
+	"user-debts": func(userID int) { findDebts(userID) },
+}
+
+// registerChecks reports on /readyz whether the config is valid, the store
+// behind each route answers and the notifications hub runs. Credentials are
+// left to LoadConfig, so servers of demoConfig are ready too.
+func registerChecks(lc *lifecycle.Manager, cfg Config, hub *NotificationHub) {
+	lc.AddReadinessCheck("config", func(context.Context) error {
+		return cfg.validateSettings()
+	})
+	for _, route := range storeRoutes {
+		lc.AddReadinessCheck("store "+route, storeCheck(route))
+	}
+	lc.AddReadinessCheck("notifications", func(context.Context) error {
+		select {
+		case <-hub.Done():
+			return errors.New("hub stopped")
+		default:
+			return nil
+		}
+	})
+}
+
+// storeCheck reads the store behind route directly, so probes don't pay
+// the latency and errors injected in the route.
+func storeCheck(route string) lifecycle.Check {
+	return func(ctx context.Context) error {
+		storeReads[route](1)
+		return ctx.Err()
+	}
+}
+
+// registerBreakerCheck reports on /readyz whether the circuits of breakers
+// are closed, for processes calling upstreams through clients
+// WithCircuitBreaker.
+func registerBreakerCheck(lc *lifecycle.Manager, breakers *Breakers) {
+	lc.AddReadinessCheck("circuit breakers", func(context.Context) error {
+		if open := breakers.Open(); len(open) > 0 {
+			return fmt.Errorf("circuit not closed for %s", strings.Join(open, ", "))
+		}
+		return nil
+	})
+}
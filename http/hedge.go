@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgePolicy decides how long to wait before firing a duplicate call.
+type HedgePolicy struct {
+	// Percentile of the observed latencies used as hedge delay, e.g. 0.95.
+	Percentile float64
+	// InitialDelay is used until MinSamples latencies have been observed.
+	InitialDelay time.Duration
+	// MinSamples needed before trusting the percentile.
+	MinSamples int
+	// WindowSize is how many recent latencies are kept per endpoint.
+	WindowSize int
+}
+
+// DefaultHedgePolicy hedges calls slower than the p95 of the last 100 calls.
+var DefaultHedgePolicy = HedgePolicy{
+	Percentile:   0.95,
+	InitialDelay: 200 * time.Millisecond,
+	MinSamples:   20,
+	WindowSize:   100,
+}
+
+// withDefaults fills the fields of p that are unset, or not positive,
+// with those of DefaultHedgePolicy.
+func (p HedgePolicy) withDefaults() HedgePolicy {
+	if p.Percentile <= 0 {
+		p.Percentile = DefaultHedgePolicy.Percentile
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = DefaultHedgePolicy.InitialDelay
+	}
+	if p.MinSamples <= 0 {
+		p.MinSamples = DefaultHedgePolicy.MinSamples
+	}
+	if p.WindowSize <= 0 {
+		p.WindowSize = DefaultHedgePolicy.WindowSize
+	}
+	return p
+}
+
+// HedgeMetrics counts how often hedges fired and won.
+type HedgeMetrics struct {
+	Calls atomic.Int64
+	Fired atomic.Int64
+	Won   atomic.Int64
+}
+
+// FireRate is the fraction of calls that fired a hedge.
+func (m *HedgeMetrics) FireRate() float64 {
+	return ratio(m.Fired.Load(), m.Calls.Load())
+}
+
+// WinRate is the fraction of fired hedges that answered first.
+func (m *HedgeMetrics) WinRate() float64 {
+	return ratio(m.Won.Load(), m.Fired.Load())
+}
+
+func ratio(a, b int64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// latencyWindow keeps the last observed latencies in a ring buffer.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, size)}
+}
+
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+func (w *latencyWindow) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.full {
+		return len(w.samples)
+	}
+	return w.next
+}
+
+// percentile returns the nearest-rank percentile p (0..1) of the window.
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	w.mu.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	w.mu.Unlock()
+
+	if n == 0 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(p*float64(n)+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= n {
+		rank = n - 1
+	}
+	return sorted[rank]
+}
+
+// endpointOf returns the first path segment of u, e.g. "balance".
+func endpointOf(u *url.URL) string {
+	return strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)[0]
+}
+
+// hedgeAttempt is the outcome of one of the calls raced by hedged.
+type hedgeAttempt struct {
+	id      int
+	resp    *http.Response
+	err     error
+	elapsed time.Duration
+}
+
+// hedged decorates fetch so that calls slower than the policy delay fire a
+// second identical call. The first successful response wins and the other
+// call is canceled. Unset fields of policy take their default.
+func hedged(fetch fetchFunc, policy HedgePolicy, metrics *HedgeMetrics) fetchFunc {
+	policy = policy.withDefaults()
+	if metrics == nil {
+		metrics = &HedgeMetrics{}
+	}
+	var mu sync.Mutex
+	windows := map[string]*latencyWindow{}
+	windowFor := func(endpoint string) *latencyWindow {
+		mu.Lock()
+		defer mu.Unlock()
+		w, ok := windows[endpoint]
+		if !ok {
+			w = newLatencyWindow(policy.WindowSize)
+			windows[endpoint] = w
+		}
+		return w
+	}
+
+	return func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		metrics.Calls.Add(1)
+		window := windowFor(endpointOf(req.URL))
+		delay := policy.InitialDelay
+		if window.len() >= policy.MinSamples {
+			delay = window.percentile(policy.Percentile)
+		}
+
+		attempts := make(chan hedgeAttempt, 2)
+		var cancels []context.CancelFunc
+		launch := func() {
+			attemptCtx, cancel := context.WithCancel(ctx)
+			id := len(cancels)
+			cancels = append(cancels, cancel)
+			go func() {
+				start := time.Now()
+				resp, err := fetch(req.Clone(attemptCtx))
+				attempts <- hedgeAttempt{id, resp, err, time.Since(start)}
+			}()
+		}
+		// cancelOthers cancels every call but keep, whose context is
+		// released when the caller closes its body.
+		cancelOthers := func(keep int) {
+			for id, cancel := range cancels {
+				if id != keep {
+					cancel()
+				}
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		launch()
+		pending := 1
+		var last *hedgeAttempt
+		for {
+			select {
+			case <-timer.C:
+				if len(cancels) == 1 {
+					metrics.Fired.Add(1)
+					pending++
+					launch()
+				}
+			case a := <-attempts:
+				pending--
+				if a.err == nil && a.resp.StatusCode < http.StatusInternalServerError {
+					window.observe(a.elapsed)
+					if a.id > 0 {
+						metrics.Won.Add(1)
+					}
+					if last != nil && last.resp != nil {
+						last.resp.Body.Close()
+					}
+					cancelOthers(a.id)
+					go discard(attempts, pending)
+					a.resp.Body = cancelOnClose{a.resp.Body, cancels[a.id]}
+					return a.resp, nil
+				}
+				if last != nil && last.resp != nil {
+					last.resp.Body.Close()
+				}
+				last = &a
+				if pending > 0 {
+					continue
+				}
+				if last.resp == nil {
+					cancelOthers(-1)
+					return nil, last.err
+				}
+				cancelOthers(last.id)
+				last.resp.Body = cancelOnClose{last.resp.Body, cancels[last.id]}
+				return last.resp, nil
+			case <-ctx.Done():
+				if last != nil && last.resp != nil {
+					last.resp.Body.Close()
+				}
+				cancelOthers(-1)
+				go discard(attempts, pending)
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+// discard closes the bodies of the n calls still in flight once they answer.
+func discard(attempts <-chan hedgeAttempt, n int) {
+	for i := 0; i < n; i++ {
+		if a := <-attempts; a.resp != nil {
+			a.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose releases the context of a winning call with its body.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyWindowPercentile(t *testing.T) {
+	w := newLatencyWindow(10)
+	for i := 1; i <= 15; i++ {
+		w.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	tt := []struct {
+		name       string
+		percentile float64
+		result     time.Duration
+	}{
+		{name: "p50", percentile: 0.5, result: 10 * time.Millisecond},
+		{name: "p90", percentile: 0.9, result: 14 * time.Millisecond},
+		{name: "p100", percentile: 1, result: 15 * time.Millisecond},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			result := w.percentile(tc.percentile)
+
+			if result != tc.result {
+				t.Errorf("unspected result, want: %s, got: %s", tc.result, result)
+			}
+		})
+	}
+}
+
+func TestHedgedCancelsSlowCall(t *testing.T) {
+	var calls, canceled atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				canceled.Add(1)
+				return
+			case <-time.After(2 * time.Second):
+			}
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	var metrics HedgeMetrics
+	policy := HedgePolicy{Percentile: 0.95, InitialDelay: 50 * time.Millisecond, MinSamples: 10, WindowSize: 10}
+	client := NewClient(srv.URL, WithHedging(policy, &metrics))
+
+	start := time.Now()
+	resp, err := client.get(context.Background(), srv.URL+"/balance/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hedge did not cut latency, took %s", elapsed)
+	}
+	if metrics.Fired.Load() != 1 || metrics.Won.Load() != 1 {
+		t.Errorf("unspected metrics, want 1 fired and 1 won, got: %d fired, %d won", metrics.Fired.Load(), metrics.Won.Load())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for canceled.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if canceled.Load() != 1 {
+		t.Errorf("slow call was not canceled")
+	}
+}
+
+func TestHedgedZeroPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	var metrics HedgeMetrics
+	client := NewClient(srv.URL, WithHedging(HedgePolicy{}, &metrics))
+	for i := 0; i < 3; i++ {
+		resp, err := client.get(context.Background(), srv.URL+"/balance/2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if metrics.Calls.Load() != 3 || metrics.Fired.Load() != 0 {
+		t.Errorf("unspected metrics, want 3 calls and none fired, got: %d calls, %d fired", metrics.Calls.Load(), metrics.Fired.Load())
+	}
+}
+
+func TestGetUserStatusHedged(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+	userID := "2"
+
+	var metrics HedgeMetrics
+	policy := HedgePolicy{Percentile: 0.95, InitialDelay: time.Second, MinSamples: 10, WindowSize: 10}
+	client := NewClient(srv.URL, WithHedging(policy, &metrics))
+
+	result, err := client.GetUserStatus(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strconv.Itoa(result.ID) != userID {
+		t.Errorf("unspected result, want %s, got: %d", userID, result.ID)
+	}
+	if metrics.Calls.Load() != 3 || metrics.Fired.Load() != 0 {
+		t.Errorf("unspected metrics, want 3 calls and 0 fired, got: %d calls, %d fired", metrics.Calls.Load(), metrics.Fired.Load())
+	}
+}
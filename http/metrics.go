@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/metrics"
+)
+
+// clientMetrics records the upstream calls of a Client.
+type clientMetrics struct {
+	calls    *metrics.CounterVec
+	duration *metrics.HistogramVec
+	retries  *metrics.CounterVec
+	breakers *metrics.GaugeVec
+}
+
+// WithMetrics records in reg every call reaching an upstream, by outcome,
+// how long it took, the retries made and the state of the circuit breakers. It should be the first option,
+// so the calls fired by retries and hedges are recorded one by one.
+func WithMetrics(reg *metrics.Registry) ClientOption {
+	return func(c *Client) {
+		c.metrics = &clientMetrics{
+			calls:    reg.Counter("client_requests_total", "Upstream calls, by upstream and status code or error.", "upstream", "code"),
+			duration: reg.Histogram("client_request_duration_seconds", "Time spent on upstream calls, by upstream.", metrics.DefaultBuckets, "upstream"),
+			retries:  reg.Counter("client_retries_total", "Upstream calls retried, by upstream.", "upstream"),
+			breakers: reg.Gauge("client_breaker_state", "Circuit breaker state, by upstream: 0 closed, 1 half-open, 2 open.", "upstream"),
+		}
+		c.fetch = c.metrics.measured(c.fetch)
+	}
+}
+
+// measured decorates fetch recording every call.
+func (m *clientMetrics) measured(fetch fetchFunc) fetchFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := fetch(req)
+		upstream := endpointOf(req.URL)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		m.calls.With(upstream, code).Inc()
+		m.duration.With(upstream).Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
+
+// retried counts a retry of req, if the client has metrics.
+func (m *clientMetrics) retried(req *http.Request) {
+	if m != nil {
+		m.retries.With(endpointOf(req.URL)).Inc()
+	}
+}
+
+// breakerState records the state of the circuit of upstream, if the client
+// has metrics.
+func (m *clientMetrics) breakerState(upstream string, state BreakerState) {
+	if m != nil {
+		m.breakers.With(upstream).Set(float64(state))
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/metrics"
+)
+
+func TestServerMetrics(t *testing.T) {
+	srv := httptest.NewServer(newHandler(benchConfig()))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	if _, err := client.GetUserStatus(context.Background(), "2"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.get(context.Background(), srv.URL+"/users?ids=nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		`http_requests_total{route="users",method="GET",code="200"} 1`,
+		`http_requests_total{route="users",method="GET",code="400"} 1`,
+		`http_requests_total{route="balance",method="GET",code="200"} 1`,
+		`http_requests_total{route="user-debts",method="GET",code="200"} 1`,
+		`http_request_duration_seconds_count{route="users",method="GET"} 2`,
+		`http_request_duration_seconds_bucket{route="balance",method="GET",le="+Inf"} 1`,
+		`http_requests_in_flight{route="users"} 0`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("unspected metrics, want line: %s, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/balance/") && calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	reg := metrics.NewRegistry()
+	client := NewClient(srv.URL,
+		WithMetrics(reg),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}),
+	)
+
+	for _, path := range []string{"/balance/2", "/users/2"} {
+		resp, err := client.get(context.Background(), srv.URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	var out strings.Builder
+	reg.WriteText(&out)
+	for _, want := range []string{
+		`client_requests_total{upstream="balance",code="200"} 1`,
+		`client_requests_total{upstream="balance",code="503"} 2`,
+		`client_requests_total{upstream="users",code="200"} 1`,
+		`client_retries_total{upstream="balance"} 2`,
+		`client_request_duration_seconds_count{upstream="balance"} 3`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("unspected metrics, want line: %s, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), `client_retries_total{upstream="users"}`) {
+		t.Errorf("unspected retries of users, got:\n%s", out.String())
+	}
+}
+
+func TestClientBreakerMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/balance/") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	reg := metrics.NewRegistry()
+	client := NewClient(srv.URL,
+		WithMetrics(reg),
+		WithCircuitBreaker(NewBreakers(BreakerPolicy{Failures: 1, Cooldown: time.Minute})),
+	)
+
+	for _, path := range []string{"/balance/2", "/users/2"} {
+		resp, err := client.get(context.Background(), srv.URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	var out strings.Builder
+	reg.WriteText(&out)
+	for _, want := range []string{
+		`client_breaker_state{upstream="balance"} 2`,
+		`client_breaker_state{upstream="users"} 0`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("unspected metrics, want line: %s, got:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// Message types of the notifications protocol. Clients send subscribe,
+// unsubscribe and ack, the server confirms subscriptions by echoing them
+// and sends event and error.
+const (
+	msgSubscribe   = "subscribe"
+	msgUnsubscribe = "unsubscribe"
+	msgEvent       = "event"
+	msgAck         = "ack"
+	msgError       = "error"
+)
+
+// Topics a client may subscribe to for a user.
+const (
+	topicBalance = "balance"
+	topicDebts   = "debts"
+)
+
+const (
+	// wsSendBuffer is how many messages may wait for a slow connection
+	// before it is evicted.
+	wsSendBuffer = 64
+	// wsMaxUnacked is how many events may wait for an ack before the
+	// connection is evicted.
+	wsMaxUnacked   = 256
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingPeriod   = wsPongTimeout * 9 / 10
+)
+
+// NotificationMessage is a message of the /notifications WebSocket:
+//
+//	-> {"type":"subscribe","topic":"balance","user_id":2}
+//	<- {"type":"subscribe","topic":"balance","user_id":2}
+//	<- {"type":"event","event_id":7,"topic":"balance","user_id":2,"data":{"user_id":2,"amount":12.50}}
+//	-> {"type":"ack","event_id":7}
+//	-> {"type":"unsubscribe","topic":"balance","user_id":2}
+type NotificationMessage struct {
+	Type    string          `json:"type"`
+	EventID int64           `json:"event_id,omitempty"`
+	Topic   string          `json:"topic,omitempty"`
+	UserID  int             `json:"user_id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// topicKey identifies the events of a topic for a user.
+type topicKey struct {
+	topic  string
+	userID int
+}
+
+// topicRoutes authorizes each topic as the route serving the same data.
+var topicRoutes = map[string]struct{ route, scope string }{
+	topicBalance: {"balance", scopeBalanceRead},
+	topicDebts:   {"user-debts", scopeDebtsRead},
+}
+
+// wsConn is a connection of the hub. Only the hub goroutine touches
+// topics and unacked.
+type wsConn struct {
+	send    chan NotificationMessage
+	topics  map[topicKey]bool
+	unacked map[int64]bool
+	// closeCode is set before closing send, so the writer can tell why the
+	// connection ends. Zero means a normal closure.
+	closeCode int
+	closeText string
+}
+
+type wsRequest struct {
+	conn *wsConn
+	msg  NotificationMessage
+}
+
+// NotificationHub fans events out to the WebSocket connections subscribed
+// to them. Its state is owned by the goroutine of Run, the rest talk to it
+// through channels.
+type NotificationHub struct {
+	broker *BalanceBroker
+
+	register   chan *wsConn
+	unregister chan *wsConn
+	requests   chan wsRequest
+	publish    chan NotificationMessage
+
+	conns  map[*wsConn]bool
+	topics map[topicKey]map[*wsConn]bool
+	feeds  map[topicKey]context.CancelFunc
+	lastID int64
+	// done is closed when Run returns.
+	done chan struct{}
+
+	// Evictions counts the connections dropped for being too slow.
+	Evictions atomic.Int64
+}
+
+// NewNotificationHub follows balance changes from broker.
+func NewNotificationHub(broker *BalanceBroker) *NotificationHub {
+	return &NotificationHub{
+		broker:     broker,
+		register:   make(chan *wsConn),
+		unregister: make(chan *wsConn),
+		requests:   make(chan wsRequest),
+		publish:    make(chan NotificationMessage, wsSendBuffer),
+		conns:      map[*wsConn]bool{},
+		done:       make(chan struct{}),
+		topics:     map[topicKey]map[*wsConn]bool{},
+		feeds:      map[topicKey]context.CancelFunc{},
+	}
+}
+
+// Publish sends an event to the subscribers of topic for userID.
+func (h *NotificationHub) Publish(topic string, userID int, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	select {
+	case h.publish <- NotificationMessage{Type: msgEvent, Topic: topic, UserID: userID, Data: raw}:
+	case <-h.done:
+	}
+}
+
+// Done is closed once the hub stopped.
+func (h *NotificationHub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Run serves the hub until ctx is done, then closes the connections as
+// going away so clients reconnect to another server.
+func (h *NotificationHub) Run(ctx context.Context) {
+	defer close(h.done)
+	for {
+		select {
+		case <-ctx.Done():
+			for c := range h.conns {
+				c.closeCode, c.closeText = websocket.CloseGoingAway, "server shutting down"
+				h.drop(c)
+			}
+			for _, stop := range h.feeds {
+				stop()
+			}
+			return
+		case c := <-h.register:
+			c.topics = map[topicKey]bool{}
+			c.unacked = map[int64]bool{}
+			h.conns[c] = true
+		case c := <-h.unregister:
+			h.drop(c)
+		case req := <-h.requests:
+			h.handle(ctx, req.conn, req.msg)
+		case msg := <-h.publish:
+			h.lastID++
+			msg.EventID = h.lastID
+			for c := range h.topics[topicKey{msg.Topic, msg.UserID}] {
+				h.deliver(c, msg)
+			}
+		}
+	}
+}
+
+func (h *NotificationHub) handle(ctx context.Context, c *wsConn, msg NotificationMessage) {
+	if c.send == nil {
+		// evicted, waiting for its reader to unregister.
+		return
+	}
+	key := topicKey{msg.Topic, msg.UserID}
+	switch msg.Type {
+	case msgSubscribe:
+		if h.topics[key] == nil {
+			h.topics[key] = map[*wsConn]bool{}
+			h.follow(ctx, key)
+		}
+		h.topics[key][c] = true
+		c.topics[key] = true
+		h.deliver(c, msg)
+		h.snapshot(c, key)
+	case msgUnsubscribe:
+		h.leave(c, key)
+		h.deliver(c, msg)
+	case msgAck:
+		delete(c.unacked, msg.EventID)
+	case msgError:
+		h.deliver(c, msg)
+	default:
+		h.deliver(c, NotificationMessage{Type: msgError, Error: "unknown message type " + msg.Type})
+	}
+}
+
+// deliver queues msg on the send buffer of c, evicting c when the buffer
+// is full or too many events are waiting for an ack.
+func (h *NotificationHub) deliver(c *wsConn, msg NotificationMessage) {
+	if c.send == nil {
+		return
+	}
+	if msg.Type == msgEvent {
+		if len(c.unacked) >= wsMaxUnacked {
+			h.evict(c)
+			return
+		}
+		c.unacked[msg.EventID] = true
+	}
+	select {
+	case c.send <- msg:
+	default:
+		h.evict(c)
+	}
+}
+
+// snapshot sends the current data of key to a new subscriber.
+func (h *NotificationHub) snapshot(c *wsConn, key topicKey) {
+	var data any
+	switch {
+	case key.topic == topicDebts:
+		data = findDebts(key.userID)
+	case h.broker != nil:
+		data = h.broker.current(key.userID)
+	default:
+		data = findBalance(key.userID)
+	}
+	raw, _ := json.Marshal(data)
+	h.lastID++
+	h.deliver(c, NotificationMessage{Type: msgEvent, EventID: h.lastID, Topic: key.topic, UserID: key.userID, Data: raw})
+}
+
+// follow forwards the balance changes of the broker while key has
+// subscribers. Debts have no source of changes other than Publish.
+func (h *NotificationHub) follow(ctx context.Context, key topicKey) {
+	if key.topic != topicBalance || h.broker == nil {
+		return
+	}
+	ctx, stop := context.WithCancel(ctx)
+	h.feeds[key] = stop
+	sub, _ := h.broker.subscribe(key.userID, 0, true)
+	go func() {
+		defer h.broker.unsubscribe(key.userID, sub)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.notify:
+				if ev, ok := sub.take(); ok {
+					raw, _ := json.Marshal(ev.Balance)
+					select {
+					case h.publish <- NotificationMessage{Type: msgEvent, Topic: key.topic, UserID: key.userID, Data: raw}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (h *NotificationHub) leave(c *wsConn, key topicKey) {
+	delete(c.topics, key)
+	delete(h.topics[key], c)
+	if len(h.topics[key]) == 0 {
+		delete(h.topics, key)
+		if stop, ok := h.feeds[key]; ok {
+			stop()
+			delete(h.feeds, key)
+		}
+	}
+}
+
+// drop forgets c and closes its send buffer, which makes its writer close
+// the connection.
+func (h *NotificationHub) drop(c *wsConn) {
+	delete(h.conns, c)
+	for key := range c.topics {
+		h.leave(c, key)
+	}
+	if c.send != nil {
+		close(c.send)
+		c.send = nil
+	}
+}
+
+func (h *NotificationHub) evict(c *wsConn) {
+	h.Evictions.Add(1)
+	c.closeCode, c.closeText = websocket.ClosePolicyViolation, "too slow"
+	h.drop(c)
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		problem.Write(w, r, problem.Wrap(status, reason))
+	},
+}
+
+// ServeWS upgrades /notifications to a WebSocket connection of the hub.
+// Subscriptions are authorized for the principal of the request.
+func (h *NotificationHub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already answered the error, as a problem.
+		return
+	}
+	send := make(chan NotificationMessage, wsSendBuffer)
+	c := &wsConn{send: send}
+	select {
+	case h.register <- c:
+	case <-h.done:
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(wsWriteTimeout))
+		ws.Close()
+		return
+	}
+	go h.writeLoop(ws, c, send)
+	h.readLoop(r.Context(), ws, c)
+}
+
+// readLoop passes the messages of the client to the hub until the
+// connection is closed.
+func (h *NotificationHub) readLoop(ctx context.Context, ws *websocket.Conn, c *wsConn) {
+	defer func() {
+		select {
+		case h.unregister <- c:
+		case <-h.done:
+		}
+		ws.Close()
+	}()
+	request := func(msg NotificationMessage) bool {
+		select {
+		case h.requests <- wsRequest{c, msg}:
+			return true
+		case <-h.done:
+			return false
+		}
+	}
+	ws.SetReadLimit(4 << 10)
+	ws.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		var msg NotificationMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type == msgSubscribe || msg.Type == msgUnsubscribe {
+			t, ok := topicRoutes[msg.Topic]
+			if !ok {
+				if !request(NotificationMessage{Type: msgError, Error: "unknown topic " + msg.Topic}) {
+					return
+				}
+				continue
+			}
+			if err := allow(ctx, t.route, t.scope, msg.UserID); err != nil {
+				if !request(NotificationMessage{Type: msgError, Topic: msg.Topic, UserID: msg.UserID, Error: err.Error()}) {
+					return
+				}
+				continue
+			}
+		}
+		if !request(msg) {
+			return
+		}
+	}
+}
+
+// writeLoop sends the messages queued for the connection and pings it,
+// until the hub closes send.
+func (h *NotificationHub) writeLoop(ws *websocket.Conn, c *wsConn, send <-chan NotificationMessage) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ping.Stop()
+		ws.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-send:
+			ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, c.closeText))
+				return
+			}
+			if err := ws.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
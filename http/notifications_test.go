@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newNotificationsServer serves a hub with no broker behind the default
+// authentication.
+func newNotificationsServer(t *testing.T) (*NotificationHub, *httptest.Server) {
+	t.Helper()
+	hub := NewNotificationHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.Run(ctx)
+	srv := httptest.NewServer(onlyAuthenticated(NewAuthenticator(demoKeys()), hub.ServeWS))
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+	})
+	return hub, srv
+}
+
+func dialNotifications(t *testing.T, srv *httptest.Server, creds Credentials) *websocket.Conn {
+	t.Helper()
+	req := &http.Request{Header: http.Header{}}
+	creds(req)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), req.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func readMessage(t *testing.T, ws *websocket.Conn) NotificationMessage {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var msg NotificationMessage
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestNotificationsSubscribe(t *testing.T) {
+	hub, srv := newNotificationsServer(t)
+	ws := dialNotifications(t, srv, defaultCredentials())
+
+	ws.WriteJSON(NotificationMessage{Type: msgSubscribe, Topic: topicDebts, UserID: 2})
+	if msg := readMessage(t, ws); msg.Type != msgSubscribe || msg.Topic != topicDebts {
+		t.Errorf("unspected message, want subscribe echo, got: %+v", msg)
+	}
+	snapshot := readMessage(t, ws)
+	if snapshot.Type != msgEvent || !strings.Contains(string(snapshot.Data), "chargeback") {
+		t.Errorf("unspected message, want debts snapshot, got: %+v", snapshot)
+	}
+	ws.WriteJSON(NotificationMessage{Type: msgAck, EventID: snapshot.EventID})
+
+	hub.Publish(topicDebts, 2, []DebtDTO{{ID: 99, Reason: "fee", Amount: 500}})
+	if msg := readMessage(t, ws); msg.Type != msgEvent || msg.EventID <= snapshot.EventID || !strings.Contains(string(msg.Data), "fee") {
+		t.Errorf("unspected message, want published event, got: %+v", msg)
+	}
+
+	ws.WriteJSON(NotificationMessage{Type: msgUnsubscribe, Topic: topicDebts, UserID: 2})
+	if msg := readMessage(t, ws); msg.Type != msgUnsubscribe {
+		t.Errorf("unspected message, want unsubscribe echo, got: %+v", msg)
+	}
+	hub.Publish(topicDebts, 2, []DebtDTO{})
+	ws.WriteJSON(NotificationMessage{Type: "ping"})
+	if msg := readMessage(t, ws); msg.Type != msgError {
+		t.Errorf("unspected message after unsubscribing, got: %+v", msg)
+	}
+}
+
+func TestNotificationsForbidden(t *testing.T) {
+	_, srv := newNotificationsServer(t)
+	token, _ := NewAuthenticator(demoKeys()).IssueToken("3", []string{scopeBalanceRead}, time.Minute)
+	ws := dialNotifications(t, srv, BearerCredentials(token))
+
+	ws.WriteJSON(NotificationMessage{Type: msgSubscribe, Topic: topicBalance, UserID: 2})
+
+	if msg := readMessage(t, ws); msg.Type != msgError || msg.UserID != 2 {
+		t.Errorf("unspected message, want error, got: %+v", msg)
+	}
+}
+
+func TestNotificationsEvictSlowClient(t *testing.T) {
+	hub, srv := newNotificationsServer(t)
+	ws := dialNotifications(t, srv, defaultCredentials())
+	ws.WriteJSON(NotificationMessage{Type: msgSubscribe, Topic: topicBalance, UserID: 2})
+
+	// the client never acks, so the hub gives up on it.
+	readMessage(t, ws)
+	for i := 0; i < wsMaxUnacked+1; i++ {
+		hub.Publish(topicBalance, 2, BalanceDTO{UserID: 2, Amount: Money(i)})
+	}
+
+	var closeErr *websocket.CloseError
+	for {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+				t.Errorf("unspected error, want close 1008, got: %v", err)
+			}
+			break
+		}
+	}
+	if hub.Evictions.Load() != 1 {
+		t.Errorf("unspected evictions, want: 1, got: %d", hub.Evictions.Load())
+	}
+}
+
+func TestNotificationsEndpoint(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+	req := &http.Request{Header: http.Header{}}
+	defaultCredentials()(req)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/notifications", req.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteJSON(NotificationMessage{Type: msgSubscribe, Topic: topicBalance, UserID: 2})
+
+	readMessage(t, ws)
+	if msg := readMessage(t, ws); msg.Type != msgEvent || !strings.Contains(string(msg.Data), `"user_id":2`) {
+		t.Errorf("unspected message, want balance snapshot, got: %+v", msg)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy sets how failed calls are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	// BaseDelay is doubled on every attempt, with jitter, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy tries each call up to 3 times.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// WithRetry retries calls failing with network errors, 429 or 502-504,
+// but not the calls refused by an open circuit.
+// Waits follow the Retry-After and RateLimit-Reset headers sent by the
+// server when present.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		// metrics may be set by a later option.
+		c.fetch = retrying(c.fetch, policy, func(req *http.Request) { c.metrics.retried(req) })
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retrying decorates fetch so idempotent calls are retried following
+// policy, calling onRetry before each retry.
+func retrying(fetch fetchFunc, policy RetryPolicy, onRetry func(*http.Request)) fetchFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			return fetch(req)
+		}
+		for attempt := 1; ; attempt++ {
+			resp, err := fetch(req)
+			if attempt >= policy.MaxAttempts || !retryable(resp, err) || req.Context().Err() != nil {
+				return resp, err
+			}
+
+			wait := backoff(policy, attempt)
+			if resp != nil {
+				if d, ok := serverDelay(resp.Header, time.Now()); ok {
+					wait = d
+				}
+				resp.Body.Close()
+			}
+			if wait > policy.MaxDelay {
+				// the server asks to wait longer than we are willing to.
+				return nil, &RetryAfterError{Wait: wait}
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			}
+			onRetry(req)
+		}
+	}
+}
+
+// RetryAfterError is returned when the server asks to retry later than the
+// retry policy allows.
+type RetryAfterError struct {
+	Wait time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return "server asked to retry after " + e.Wait.String()
+}
+
+// backoff is the exponential delay with full jitter before retry attempt.
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	d := policy.BaseDelay << (attempt - 1)
+	if d <= 0 || d > policy.MaxDelay {
+		d = policy.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// serverDelay reads how long the server asked to wait, from Retry-After in
+// seconds or as a date, or from RateLimit-Reset when no tokens remain.
+func serverDelay(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if date, err := http.ParseTime(v); err == nil {
+			if d := date.Sub(now); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+	}
+	if h.Get("RateLimit-Remaining") == "0" {
+		if secs, err := strconv.Atoi(h.Get("RateLimit-Reset")); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/middleware"
+)
+
+func TestServerDelay(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name   string
+		header http.Header
+		delay  time.Duration
+		ok     bool
+	}{
+		{name: "retry after seconds", header: http.Header{"Retry-After": {"2"}}, delay: 2 * time.Second, ok: true},
+		{name: "retry after date", header: http.Header{"Retry-After": {now.Add(3 * time.Second).Format(http.TimeFormat)}}, delay: 3 * time.Second, ok: true},
+		{name: "rate limit exhausted", header: http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"1"}}, delay: time.Second, ok: true},
+		{name: "rate limit left", header: http.Header{"Ratelimit-Remaining": {"4"}, "Ratelimit-Reset": {"1"}}, ok: false},
+		{name: "no headers", header: http.Header{}, ok: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			delay, ok := serverDelay(tc.header, now)
+
+			if delay != tc.delay || ok != tc.ok {
+				t.Errorf("unspected result, want: %s %t, got: %s %t", tc.delay, tc.ok, delay, ok)
+			}
+		})
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	cfg := demoConfig()
+	cfg.Routes = nil
+	cfg.RateLimits = map[string]middleware.Limit{"balance": {Rate: 1, Burst: 2}}
+	srv := httptest.NewServer(newHandler(cfg))
+	defer srv.Close()
+
+	var last *http.Response
+	for i := 0; i < 3; i++ {
+		resp, err := authGet(context.Background(), srv.URL+"/balance/2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		last = resp
+	}
+
+	if last.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unspected status, want 429, got: %d", last.StatusCode)
+	}
+	if last.Header.Get("Retry-After") != "1" || last.Header.Get("RateLimit-Remaining") != "0" || last.Header.Get("RateLimit-Limit") != "2" {
+		t.Errorf("unspected rate limit headers, got: %v", last.Header)
+	}
+
+	// a different principal has its own bucket.
+	token, err := NewAuthenticator(demoKeys()).IssueToken("2", []string{scopeBalanceRead}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/balance/2", nil)
+	BearerCredentials(token)(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unspected status, principal 2 shared the bucket of the demo key, got: %d", resp.StatusCode)
+	}
+}
+
+func TestServerRateLimitKeyedByPrincipal(t *testing.T) {
+	cfg := demoConfig()
+	cfg.Routes = nil
+	cfg.RateLimits = map[string]middleware.Limit{"balance": {Rate: 1, Burst: 2}}
+	srv := httptest.NewServer(newHandler(cfg))
+	defer srv.Close()
+	token, err := NewAuthenticator(demoKeys()).IssueToken("2", []string{scopeBalanceRead}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// neither junk API keys nor spacing variations give fresh buckets.
+	var statuses []int
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/balance/2", nil)
+		req.Header.Set("Authorization", "Bearer "+token+strings.Repeat(" ", i))
+		req.Header.Set("X-API-Key", fmt.Sprint("junk-", i))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("unspected statuses, want: %v, got: %v", want, statuses)
+	}
+}
+
+func TestClientRetriesAfterRateLimit(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}))
+	start := time.Now()
+	resp, err := client.get(context.Background(), srv.URL+"/balance/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("unspected result, want 200 after 2 calls, got: %d after %d calls", resp.StatusCode, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("client did not honor Retry-After, retried after %s", elapsed)
+	}
+
+	impatient := NewClient(srv.URL, WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 100 * time.Millisecond}))
+	calls.Store(0)
+	if _, err := impatient.get(context.Background(), srv.URL+"/balance/2"); err == nil {
+		t.Errorf("unspected result, want RetryAfterError, got nil")
+	}
+}
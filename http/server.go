@@ -1,81 +1,325 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+	"github.com/jegutierrez/functional_patterns_go/logging"
+	"github.com/jegutierrez/functional_patterns_go/metrics"
+	"github.com/jegutierrez/functional_patterns_go/middleware"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+	"github.com/jegutierrez/functional_patterns_go/router"
+	"github.com/jegutierrez/functional_patterns_go/tracing"
 )
 
 func main() {
-	err := http.ListenAndServe(":8080", handler())
+	cfg, err := LoadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		fatal("loading config", err)
+	}
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
 	if err != nil {
-		log.Fatal(err)
+		fatal("creating logger", err)
+	}
+	slog.SetDefault(logger)
+	lc := lifecycle.New(
+		lifecycle.WithDrainTimeout(time.Duration(cfg.Shutdown.Drain)),
+		lifecycle.WithShutdownDelay(time.Duration(cfg.Shutdown.Delay)),
+	)
+	if cfg.GRPCAddr != "" {
+		if err := serveGRPC(lc, cfg); err != nil {
+			fatal("serving gRPC", err)
+		}
 	}
+	tracer, err := newTracer(cfg.Tracing, lc)
+	if err != nil {
+		fatal("creating tracer", err)
+	}
+	lc.AddServer(&http.Server{Addr: cfg.Addr, Handler: newManagedHandler(cfg, lc, tracer)}, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err := lc.Run(context.Background()); err != nil {
+		fatal("serving", err)
+	}
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func handler() http.Handler {
-	srv := http.NewServeMux()
-	srv.HandleFunc("/users/", userHandler)
-	srv.HandleFunc("/balance/", onlyAuthenticated(balanceHandler))
-	srv.HandleFunc("/user-debts/", debtsHandler)
-	log.Println("server listening connections")
-	return srv
+	return newHandler(demoConfig())
 }
 
-func userHandler(w http.ResponseWriter, r *http.Request) {
-	userID := strings.TrimPrefix(r.URL.Path, "/users/")
-	user := map[string]string{"id": userID, "name": "user" + userID}
+// demoConfig is DefaultConfig accepting the demo credentials, for handler()
+// and tests. Configs built by LoadConfig never accept them.
+func demoConfig() Config {
+	cfg := DefaultConfig()
+	cfg.Auth = demoKeys()
+	return cfg
+}
 
-	// delay
-	time.Sleep(150 * time.Millisecond)
+// newHandler serves cfg outside of a lifecycle, for tests. Requests are
+// traced with defaultTracer, continuing the trace of the caller.
+func newHandler(cfg Config) http.Handler {
+	return newManagedHandler(cfg, lifecycle.New(lifecycle.Unmanaged()), defaultTracer)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+// newTracer exports spans as configured, flushing them when lc closes.
+func newTracer(cfg TracingConfig, lc *lifecycle.Manager) (tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch {
+	case cfg.OTLPEndpoint != "":
+		exporter = tracing.NewOTLPExporter(cfg.OTLPEndpoint)
+	case cfg.File != "":
+		file, err := tracing.NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		exporter = file
+	default:
+		return tracing.Noop(), nil
+	}
+	provider := tracing.New("server", exporter)
+	lc.OnClose("tracer", provider.Shutdown)
+	return provider, nil
 }
 
-func onlyAuthenticated(h http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if !isAuth(r) {
-			w.WriteHeader(http.StatusNotFound)
-			return
+// newManagedHandler serves cfg, ending its streams and WebSockets when lc
+// drains and answering its checks on /healthz and /readyz. Requests are
+// traced with tracer.
+func newManagedHandler(cfg Config, lc *lifecycle.Manager, tracer tracing.Tracer) http.Handler {
+	auth := NewAuthenticator(cfg.Auth)
+	faults := NewFaultInjector(cfg.Routes, cfg.FaultAdmin)
+	limiter := middleware.NewRateLimiter(rateLimitKey)
+	reg := metrics.NewRegistry()
+	routeMetrics := middleware.NewRouteMetrics(reg)
+	observed := func(name string) middleware.Middleware {
+		return middleware.Chain(middleware.LogRoute(name, userIDOf), routeMetrics.Route(name), middleware.Trace(tracer, name))
+	}
+	// limited must run after onlyAuthenticated, see rateLimitKey.
+	limited := func(name string, h http.HandlerFunc) http.HandlerFunc {
+		if limit, ok := cfg.RateLimits[name]; ok {
+			return limiter.Limit(name, limit)(h)
 		}
-		h(w, r)
+		return h
+	}
+	secured := func(name, scope string, h http.HandlerFunc) http.HandlerFunc {
+		return onlyAuthenticated(auth, limited(name, requireScope(scope, authorize(routePolicies[name], h))))
 	}
+	guarded := func(name, scope string, h http.HandlerFunc) http.HandlerFunc {
+		return secured(name, scope, faults.Middleware(name)(h))
+	}
+	route := func(name, scope string, h http.HandlerFunc) http.HandlerFunc {
+		return observed(name)(guarded(name, scope, h))
+	}
+
+	rt := router.New()
+	rt.Handle(http.MethodGet, "/users/{id:int}", route("users", scopeUsersRead, problem.Handle(userHandler)))
+	rt.Handle(http.MethodGet, "/balance/{id:int}", route("balance", scopeBalanceRead, problem.Handle(balanceHandler)))
+	broker := NewBalanceBroker(time.Duration(cfg.Stream.Tick))
+	// faults buffer whole responses, so streams are served without them.
+	rt.Handle(http.MethodGet, "/balance/{id:int}/stream", observed("balance-stream")(secured("balance", scopeBalanceRead, problem.Handle(balanceStreamHandler(broker, time.Duration(cfg.Stream.Heartbeat))))))
+	lc.OnDrain("balance streams", func(context.Context) error {
+		broker.Close()
+		return nil
+	})
+	hub := NewNotificationHub(broker)
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	go hub.Run(hubCtx)
+	lc.OnDrain("notifications", func(ctx context.Context) error {
+		stopHub()
+		select {
+		case <-hub.Done():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	rt.Handle(http.MethodGet, "/notifications", observed("notifications")(onlyAuthenticated(auth, limited("notifications", hub.ServeWS))))
+	rt.Handle(http.MethodGet, "/user-debts/{id:int}", route("user-debts", scopeDebtsRead, problem.Handle(debtsHandler)))
+	rt.Handle(http.MethodGet, "/users", route("users", scopeUsersRead, problem.Handle(usersBatchHandler)))
+	rt.Handle(http.MethodGet, "/balance", route("balance", scopeBalanceRead, problem.Handle(balancesBatchHandler)))
+	rt.Handle(http.MethodGet, "/user-debts", route("user-debts", scopeDebtsRead, problem.Handle(debtsBatchHandler)))
+	rt.Handle(http.MethodGet, "/user-status/{id:int}", route("user-status", scopeUsersRead,
+		requireScope(scopeBalanceRead, requireScope(scopeDebtsRead, problem.Handle(userStatusHandler(faults, cfg.StatusTimeouts))))))
+	// graphql authorizes each field as the route serving its data.
+	graphql := observed("graphql")(onlyAuthenticated(auth, limited("graphql", problem.Handle(graphqlHandler(faults, cfg.StatusTimeouts)))))
+	rt.Handle(http.MethodGet, "/graphql", graphql)
+	rt.Handle(http.MethodPost, "/graphql", graphql)
+	registerChecks(lc, cfg, hub)
+	rt.Handle(http.MethodGet, "/metrics", reg.Handler())
+	rt.Handle(http.MethodGet, "/healthz", lc.LivenessHandler())
+	rt.Handle(http.MethodGet, "/readyz", lc.ReadinessHandler())
+	if cfg.FaultAdmin {
+		admin := func(h problem.HandlerFunc) http.HandlerFunc {
+			return onlyAuthenticated(auth, requireRole(roleAdmin, problem.Handle(h)))
+		}
+		rt.Handle(http.MethodGet, "/admin/faults", admin(faults.listPlans))
+		rt.Handle(http.MethodGet, "/admin/faults/{route}", admin(faults.getPlan))
+		rt.Handle(http.MethodPut, "/admin/faults/{route}", admin(faults.putPlan))
+		rt.Handle(http.MethodDelete, "/admin/faults/{route}", admin(faults.deletePlan))
+	}
+	logger := slog.Default()
+	logger.Info("server listening connections", "addr", cfg.Addr)
+	return middleware.Chain(
+		middleware.RequestID(),
+		middleware.Logger(logger),
+		middleware.AccessLog(),
+		middleware.Recover(),
+		middleware.Gzip(),
+		middleware.MaxBodyBytes(1<<20),
+	).Handler(rt)
 }
 
-func isAuth(r *http.Request) bool {
-	return true
+// userIDOf returns the user a request is about, as logged: the {id} of
+// its route.
+func userIDOf(r *http.Request) string {
+	return r.PathValue("id")
 }
 
-func balanceHandler(w http.ResponseWriter, r *http.Request) {
-	userID := strings.TrimPrefix(r.URL.Path, "/balance/")
-	amount := fmt.Sprint(rand.Intn(100), ",", rand.Intn(100))
-	balance := map[string]string{"user_id": userID, "amount": amount}
+// rateLimitKey accounts requests to the principal authenticated for them,
+// however its credentials are sent, or to the client IP when there is none.
+func rateLimitKey(r *http.Request) string {
+	if principal, ok := PrincipalFrom(r.Context()); ok {
+		return "principal:" + principal.Subject
+	}
+	return "ip:" + middleware.ClientIP(r)
+}
 
-	// delay
-	time.Sleep(350 * time.Millisecond)
+func userHandler(w http.ResponseWriter, r *http.Request) error {
+	userID := router.Int(r, "id")
+	user := findUser(userID)
+
+	// user info rarely changes, let clients cache and revalidate it.
+	etag := fmt.Sprintf(`"user-%d"`, userID)
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+	return nil
+}
+
+func balanceHandler(w http.ResponseWriter, r *http.Request) error {
+	userID := router.Int(r, "id")
+	balance := findBalance(userID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(balance)
+	return nil
+}
+
+// debtsHandler serves a page of the debts of the user, filtered and sorted
+// as asked by the query. The Link header points to the next page.
+func debtsHandler(w http.ResponseWriter, r *http.Request) error {
+	q, err := parseDebtQuery(r)
+	if err != nil {
+		return err
+	}
+	debts, next := defaultDebts.Find(router.Int(r, "id"), q)
+	if next != "" {
+		w.Header().Set("Link", nextPageLink(r, next))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(debts)
+	return nil
+}
+
+// usersBatchHandler serves /users?ids=1,2,3 paying the delay only once.
+func usersBatchHandler(w http.ResponseWriter, r *http.Request) error {
+	ids, err := batchIDs(r)
+	if err != nil {
+		return err
+	}
+	users := make([]UserDTO, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, findUser(id))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+	return nil
 }
 
-func debtsHandler(w http.ResponseWriter, r *http.Request) {
-	debts := []struct {
-		ID     string `json:"id"`
-		Reason string `json:"reason"`
-		Amount string `json:"amount"`
-	}{
-		{ID: "14", Reason: "chargeback", Amount: "71.0"},
-		{ID: "37", Reason: "chargeback", Amount: "15.5"},
-		{ID: "51", Reason: "chargeback", Amount: "43.0"},
+// balancesBatchHandler serves /balance?ids=1,2,3 paying the delay only once.
+func balancesBatchHandler(w http.ResponseWriter, r *http.Request) error {
+	ids, err := batchIDs(r)
+	if err != nil {
+		return err
+	}
+	balances := make([]BalanceDTO, 0, len(ids))
+	for _, id := range ids {
+		balances = append(balances, findBalance(id))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balances)
+	return nil
+}
+
+// debtsBatchHandler serves /user-debts?ids=1,2,3 as debts keyed by user ID.
+func debtsBatchHandler(w http.ResponseWriter, r *http.Request) error {
+	ids, err := batchIDs(r)
+	if err != nil {
+		return err
+	}
+	debts := make(map[int][]DebtDTO, len(ids))
+	for _, id := range ids {
+		debts[id] = findDebts(id)
 	}
-	// delay
-	time.Sleep(250 * time.Millisecond)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(debts)
+	return nil
+}
+
+// maxBatchIDs caps how many users a single batch request may ask for.
+const maxBatchIDs = 100
+
+// batchIDs reads the ids query param, failing with a 400 when it is
+// invalid.
+func batchIDs(r *http.Request) ([]int, error) {
+	var ids []int
+	for _, raw := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, problem.BadRequest("user ID %q is not a number", raw)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 || len(ids) > maxBatchIDs {
+		return nil, problem.BadRequest("ids must list between 1 and %d user IDs", maxBatchIDs)
+	}
+	return ids, nil
+}
+
+func findUser(userID int) UserDTO {
+	return UserDTO{ID: userID, Name: fmt.Sprint("user", userID)}
+}
+
+func findBalance(userID int) BalanceDTO {
+	amount := Money(rand.Intn(100)*100 + rand.Intn(100))
+	return BalanceDTO{UserID: userID, Amount: amount}
+}
+
+func findDebts(userID int) []DebtDTO {
+	return defaultDebts.All(userID)
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+func TestShutdownEndsStreams(t *testing.T) {
+	lc := lifecycle.New(lifecycle.WithLogger(slog.New(slog.DiscardHandler)))
+	srv := httptest.NewServer(newManagedHandler(benchConfig(), lc, tracing.Noop()))
+	defer srv.Close()
+	done := make(chan error, 1)
+	go func() { done <- lc.Run(context.Background()) }()
+
+	readyz := func() int {
+		res, err := http.Get(srv.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	deadline := time.Now().Add(time.Second)
+	for readyz() != http.StatusOK && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/balance/2/stream", nil)
+	defaultCredentials()(req)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/notifications", req.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	lc.Shutdown()
+	if err := <-done; err != nil {
+		t.Fatalf("unspected error, want: nil, got: %v", err)
+	}
+
+	if got := readyz(); got != http.StatusServiceUnavailable {
+		t.Errorf("unspected readiness, want: %d, got: %d", http.StatusServiceUnavailable, got)
+	}
+	ended := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(stream.Body)
+		ended <- err
+	}()
+	select {
+	case err := <-ended:
+		if err != nil {
+			t.Errorf("unspected stream error, want: nil, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("unspected result, want: stream ended, got: still open")
+	}
+	var closeErr *websocket.CloseError
+	for {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+				t.Errorf("unspected error, want close 1001, got: %v", err)
+			}
+			break
+		}
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	cfg := benchConfig()
+	cfg.Routes = map[string]RouteConfig{"balance": {ErrorRate: 1, Latency: Fixed(time.Minute)}}
+	ready := newManagedHandler(cfg, lifecycle.New(lifecycle.Unmanaged()), tracing.Noop())
+	cfg.Addr = ""
+	misconfigured := newManagedHandler(cfg, lifecycle.New(lifecycle.Unmanaged()), tracing.Noop())
+
+	tt := []struct {
+		name    string
+		handler http.Handler
+		status  int
+		failed  map[string]string
+	}{
+		{name: "faults in routes", handler: ready, status: http.StatusOK, failed: map[string]string{}},
+		{name: "invalid config", handler: misconfigured, status: http.StatusServiceUnavailable, failed: map[string]string{"config": "addr must not be empty"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			var report lifecycle.Report
+			if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+
+			failed := map[string]string{}
+			for _, check := range report.Checks {
+				if check.Status != lifecycle.StatusOK {
+					failed[check.Name] = check.Error
+				}
+			}
+			if rr.Code != tc.status || !reflect.DeepEqual(failed, tc.failed) {
+				t.Errorf("unspected readiness, want: %d %v, got: %d %v", tc.status, tc.failed, rr.Code, failed)
+			}
+		})
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	srv := httptest.NewServer(newHandler(benchConfig()))
+	defer srv.Close()
+
+	tt := []struct {
+		name        string
+		path        string
+		credentials Credentials
+		status      int
+	}{
+		{name: "not a number", path: "/users/abc", credentials: defaultCredentials(), status: http.StatusBadRequest},
+		{name: "invalid batch", path: "/balance?ids=1,x", credentials: defaultCredentials(), status: http.StatusBadRequest},
+		{name: "unauthenticated", path: "/user-debts/2", credentials: func(*http.Request) {}, status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tc.path, nil)
+			tc.credentials(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var details problem.Details
+			if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.status || resp.Header.Get("Content-Type") != problem.ContentType || details.Status != tc.status || details.Detail == "" {
+				t.Errorf("unspected response, want: %d problem, got: %d %s %+v", tc.status, resp.StatusCode, resp.Header.Get("Content-Type"), details)
+			}
+		})
+	}
+}
+
+func TestHandlerReadyOutsideLifecycle(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("unspected readiness, want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+	"github.com/jegutierrez/functional_patterns_go/router"
+)
+
+// sectionResult is the outcome of looking up one section of a UserStatus.
+type sectionResult[T any] struct {
+	value T
+	err   error
+}
+
+// fetchSection looks up a section in its own goroutine, paying the latency
+// and errors planned for route as the standalone endpoint would, and gives
+// up after timeout when it is set.
+func fetchSection[T any](ctx context.Context, faults *FaultInjector, route string, timeout time.Duration, find func() T) <-chan sectionResult[T] {
+	ch := make(chan sectionResult[T], 1)
+	go func() {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		plan := faults.Plan(route)
+		select {
+		case <-time.After(plan.Latency.Sample()):
+		case <-ctx.Done():
+			ch <- sectionResult[T]{err: fmt.Errorf("%s: %w", route, ctx.Err())}
+			return
+		}
+		if chance(plan.ErrorRate) {
+			ch <- sectionResult[T]{err: fmt.Errorf("%s: injected error", route)}
+			return
+		}
+		ch <- sectionResult[T]{value: find()}
+	}()
+	return ch
+}
+
+// lookupUserStatus looks up the user, balance and debts of userID
+// concurrently and joins them. Each section is bounded by its timeout in
+// timeouts, keyed by route.
+func lookupUserStatus(ctx context.Context, faults *FaultInjector, timeouts map[string]Duration, userID int) (UserStatus, error) {
+	userCall := fetchSection(ctx, faults, "users", time.Duration(timeouts["users"]), func() UserDTO {
+		return findUser(userID)
+	})
+	balanceCall := fetchSection(ctx, faults, "balance", time.Duration(timeouts["balance"]), func() BalanceDTO {
+		return findBalance(userID)
+	})
+	debtsCall := fetchSection(ctx, faults, "user-debts", time.Duration(timeouts["user-debts"]), func() []DebtDTO {
+		return findDebts(userID)
+	})
+	user, balance, debts := <-userCall, <-balanceCall, <-debtsCall
+
+	if err := errors.Join(user.err, balance.err, debts.err); err != nil {
+		return UserStatus{}, err
+	}
+	return newUserStatus(user.value, balance.value, debts.value), nil
+}
+
+// userStatusHandler serves /user-status/{id}, so clients need a single call
+// to get the whole user status.
+func userStatusHandler(faults *FaultInjector, timeouts map[string]Duration) problem.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		status, err := lookupUserStatus(r.Context(), faults, timeouts, router.Int(r, "id"))
+		if err != nil {
+			code := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				code = http.StatusGatewayTimeout
+			}
+			return problem.Wrap(code, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return nil
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetUserStatusAggregated(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+
+	start := time.Now()
+	result, err := NewClient(srv.URL).GetUserStatusAggregated(context.Background(), "2")
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.ID != 2 || result.Name != "user2" || len(result.Debts) != 3 {
+		t.Errorf("unspected result, got: %+v", result)
+	}
+	// sections run concurrently, so it takes about as long as the slowest.
+	if elapsed > 600*time.Millisecond {
+		t.Errorf("sections did not run concurrently, took %s", elapsed)
+	}
+}
+
+func TestUserStatusSectionTimeout(t *testing.T) {
+	cfg := demoConfig()
+	cfg.StatusTimeouts = map[string]Duration{"balance": Duration(20 * time.Millisecond)}
+	srv := httptest.NewServer(newHandler(cfg))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL).GetUserStatusAggregated(context.Background(), "2")
+
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Status != http.StatusGatewayTimeout {
+		t.Errorf("unspected result, want status %d, got: %v", http.StatusGatewayTimeout, err)
+	}
+}
+
+func TestUserStatusAuthorization(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+	auth := NewAuthenticator(demoKeys())
+
+	tt := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{name: "every scope", scopes: []string{scopeUsersRead, scopeBalanceRead, scopeDebtsRead}, status: http.StatusOK},
+		{name: "missing debts scope", scopes: []string{scopeUsersRead, scopeBalanceRead}, status: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := auth.IssueToken("2", tc.scopes, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/user-status/2", nil)
+			BearerCredentials(token)(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.status {
+				t.Errorf("unspected status, want: %d, got: %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
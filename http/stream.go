@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+	"github.com/jegutierrez/functional_patterns_go/router"
+)
+
+const (
+	// balanceHistorySize is how many events of each user are kept to replay
+	// to clients reconnecting with Last-Event-ID.
+	balanceHistorySize = 100
+	// streamWriteTimeout disconnects clients that stop reading.
+	streamWriteTimeout = 10 * time.Second
+	// streamRetry tells clients how long to wait before reconnecting.
+	streamRetry = 3 * time.Second
+)
+
+// BalanceEvent is a balance change, numbered per user.
+type BalanceEvent struct {
+	ID      int64
+	Balance BalanceDTO
+}
+
+// BalanceBroker publishes the balance changes of each user to the streams
+// subscribed to it. While a user has subscribers its balance changes every
+// tick, simulating the activity of the account.
+type BalanceBroker struct {
+	tick time.Duration
+
+	mu    sync.Mutex
+	feeds map[int]*balanceFeed
+	// closed ends the streams, see Close.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// balanceFeed holds the recent events and subscribers of a user.
+type balanceFeed struct {
+	lastID  int64
+	history []BalanceEvent
+	subs    map[*balanceSubscriber]bool
+	stop    chan struct{}
+}
+
+// balanceSubscriber only keeps the latest event not sent yet, so a slow
+// client skips intermediate balances instead of slowing down the broker.
+type balanceSubscriber struct {
+	mu     sync.Mutex
+	latest *BalanceEvent
+	notify chan struct{}
+}
+
+func (s *balanceSubscriber) push(ev BalanceEvent) {
+	s.mu.Lock()
+	s.latest = &ev
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *balanceSubscriber) take() (BalanceEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest == nil {
+		return BalanceEvent{}, false
+	}
+	ev := *s.latest
+	s.latest = nil
+	return ev, true
+}
+
+// NewBalanceBroker changes the balance of subscribed users every tick, or
+// only on Publish when tick is zero.
+func NewBalanceBroker(tick time.Duration) *BalanceBroker {
+	return &BalanceBroker{tick: tick, feeds: map[int]*balanceFeed{}, closed: make(chan struct{})}
+}
+
+// Close ends the streams being served, so a server shutting down doesn't
+// wait for them. Clients reconnect on their own, resuming from the last
+// event they got.
+func (b *BalanceBroker) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+}
+
+// Publish sends a balance change to the subscribers of its user.
+func (b *BalanceBroker) Publish(balance BalanceDTO) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.publish(b.feed(balance.UserID), balance)
+}
+
+func (b *BalanceBroker) feed(userID int) *balanceFeed {
+	f, ok := b.feeds[userID]
+	if !ok {
+		f = &balanceFeed{subs: map[*balanceSubscriber]bool{}}
+		b.feeds[userID] = f
+	}
+	return f
+}
+
+func (b *BalanceBroker) publish(f *balanceFeed, balance BalanceDTO) {
+	f.lastID++
+	ev := BalanceEvent{ID: f.lastID, Balance: balance}
+	f.history = append(f.history, ev)
+	if len(f.history) > balanceHistorySize {
+		f.history = f.history[len(f.history)-balanceHistorySize:]
+	}
+	for sub := range f.subs {
+		sub.push(ev)
+	}
+}
+
+// subscribe returns a subscriber to the changes of userID and the events
+// to send first: the ones after lastID when the client is reconnecting,
+// or the current balance otherwise.
+func (b *BalanceBroker) subscribe(userID int, lastID int64, reconnecting bool) (*balanceSubscriber, []BalanceEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f := b.feed(userID)
+	if len(f.history) == 0 {
+		if reconnecting {
+			// the feed was dropped while the client was away, keep its
+			// event IDs growing.
+			f.lastID = lastID
+		}
+		b.publish(f, findBalance(userID))
+	}
+	sub := &balanceSubscriber{notify: make(chan struct{}, 1)}
+	f.subs[sub] = true
+	if len(f.subs) == 1 && b.tick > 0 {
+		f.stop = make(chan struct{})
+		go b.simulate(userID, f, f.stop)
+	}
+
+	replay := f.history[len(f.history)-1:]
+	if reconnecting {
+		replay = nil
+		for _, ev := range f.history {
+			if ev.ID > lastID {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	return sub, append([]BalanceEvent(nil), replay...)
+}
+
+// current returns the latest balance of userID, without keeping a feed
+// for users nobody is subscribed to.
+func (b *BalanceBroker) current(userID int) BalanceDTO {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if f, ok := b.feeds[userID]; ok && len(f.history) > 0 {
+		return f.history[len(f.history)-1].Balance
+	}
+	return findBalance(userID)
+}
+
+// unsubscribe removes sub from the feed of userID, dropping the feed and
+// its history when sub was the last subscriber.
+func (b *BalanceBroker) unsubscribe(userID int, sub *balanceSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f := b.feeds[userID]
+	delete(f.subs, sub)
+	if len(f.subs) > 0 {
+		return
+	}
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+	delete(b.feeds, userID)
+}
+
+// simulate changes the balance of f every tick until stop is closed.
+func (b *BalanceBroker) simulate(userID int, f *balanceFeed, stop <-chan struct{}) {
+	ticker := time.NewTicker(b.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			// stop is closed holding mu, checking it here keeps a late
+			// tick from publishing to a dropped feed.
+			select {
+			case <-stop:
+				b.mu.Unlock()
+				return
+			default:
+			}
+			b.publish(f, findBalance(userID))
+			b.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// balanceStreamHandler serves /balance/{id}/stream as Server-Sent Events,
+// with a comment every heartbeat so idle connections are kept alive.
+func balanceStreamHandler(broker *BalanceBroker, heartbeat time.Duration) problem.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userID := router.Int(r, "id")
+		var lastID int64
+		raw := r.Header.Get("Last-Event-ID")
+		if raw != "" {
+			var err error
+			if lastID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				return problem.BadRequest("Last-Event-ID is not a number")
+			}
+		}
+
+		sub, replay := broker.subscribe(userID, lastID, raw != "")
+		defer broker.unsubscribe(userID, sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		write := func(s string) bool {
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := io.WriteString(w, s); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+
+		if !write(fmt.Sprintf("retry: %d\n\n", streamRetry.Milliseconds())) {
+			return nil
+		}
+		for _, ev := range replay {
+			if !write(formatBalanceEvent(ev)) {
+				return nil
+			}
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-broker.closed:
+				return nil
+			case <-ticker.C:
+				if !write(": heartbeat\n\n") {
+					return nil
+				}
+			case <-sub.notify:
+				if ev, ok := sub.take(); ok && !write(formatBalanceEvent(ev)) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func formatBalanceEvent(ev BalanceEvent) string {
+	data, _ := json.Marshal(ev.Balance)
+	return fmt.Sprintf("id: %d\nevent: balance\ndata: %s\n\n", ev.ID, data)
+}
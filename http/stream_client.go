@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamIdleTimeout reconnects streams that got neither events nor
+// heartbeats for that long.
+const streamIdleTimeout = 45 * time.Second
+
+// BalanceUpdate is a balance pushed by the server, or the error that ended
+// the stream.
+type BalanceUpdate struct {
+	EventID string
+	Balance BalanceDTO
+	Err     error
+}
+
+// StreamBalance follows the balance changes of userID, reconnecting with
+// Last-Event-ID when the connection drops so no update is lost. The channel
+// is closed when ctx is done or after an update with the error of the
+// server refusing the stream for good, as a 401 or 403.
+//
+// Streams skip the decorators of the client, a stream can't be hedged,
+// cached nor retried as a whole.
+func (c *Client) StreamBalance(ctx context.Context, userID string) <-chan BalanceUpdate {
+	updates := make(chan BalanceUpdate)
+	go func() {
+		defer close(updates)
+		var lastEventID string
+		retry := streamRetry
+		for {
+			err := c.streamBalance(ctx, userID, &lastEventID, &retry, updates)
+			if ctx.Err() != nil {
+				return
+			}
+			var respErr *ResponseError
+			if errors.As(err, &respErr) && respErr.Status < 500 && respErr.Status != http.StatusTooManyRequests {
+				select {
+				case updates <- BalanceUpdate{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates
+}
+
+// streamBalance reads a single connection of the stream, keeping track of
+// the last event seen and the reconnection delay asked by the server.
+func (c *Client) streamBalance(ctx context.Context, userID string, lastEventID *string, retry *time.Duration, updates chan<- BalanceUpdate) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	idle := time.AfterFunc(streamIdleTimeout, cancel)
+	defer idle.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/balance/%s/stream", c.serverURL, userID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+	c.credentials(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &ResponseError{Upstream: upstreamOf(resp), Status: resp.StatusCode, Err: ErrUnexpectedStatus}
+	}
+
+	var id, event string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		idle.Reset(streamIdleTimeout)
+		line := scanner.Text()
+		if line == "" {
+			// a blank line dispatches the event read so far.
+			if event == "balance" && len(data) > 0 {
+				var balance BalanceDTO
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &balance); err == nil {
+					*lastEventID = id
+					select {
+					case updates <- BalanceUpdate{EventID: id, Balance: balance}:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				*retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/router"
+)
+
+// newStreamServer serves balanceStreamHandler with broker, without auth.
+func newStreamServer(broker *BalanceBroker, heartbeat time.Duration) *httptest.Server {
+	rt := router.New()
+	rt.HandleFunc(http.MethodGet, "/balance/{id:int}/stream", balanceStreamHandler(broker, heartbeat))
+	return httptest.NewServer(rt)
+}
+
+// readStream returns the first n non empty lines of the stream of user 2.
+func readStream(t *testing.T, srv *httptest.Server, lastEventID string, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/balance/2/stream", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(lines) < n && scanner.Scan() {
+		if scanner.Text() != "" {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	return lines
+}
+
+func TestBalanceStreamReplay(t *testing.T) {
+	broker := NewBalanceBroker(0)
+	for _, amount := range []Money{100, 200, 300} {
+		broker.Publish(BalanceDTO{UserID: 2, Amount: amount})
+	}
+	srv := newStreamServer(broker, time.Minute)
+	defer srv.Close()
+
+	tt := []struct {
+		name        string
+		lastEventID string
+		want        []string
+	}{
+		{name: "current balance", want: []string{"retry: 3000", "id: 3", "event: balance", `data: {"user_id":2,"amount":3.00}`}},
+		{name: "reconnecting", lastEventID: "1", want: []string{"retry: 3000", "id: 2", "event: balance", `data: {"user_id":2,"amount":2.00}`, "id: 3"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			lines := readStream(t, srv, tc.lastEventID, len(tc.want))
+
+			if strings.Join(lines, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("unspected stream, want: %q, got: %q", tc.want, lines)
+			}
+		})
+	}
+}
+
+func TestBalanceStreamHeartbeat(t *testing.T) {
+	srv := newStreamServer(NewBalanceBroker(0), 10*time.Millisecond)
+	defer srv.Close()
+
+	lines := readStream(t, srv, "", 5)
+
+	if lines[len(lines)-1] != ": heartbeat" {
+		t.Errorf("unspected stream, want a heartbeat, got: %q", lines)
+	}
+}
+
+func TestBalanceSubscriberKeepsLatest(t *testing.T) {
+	sub := &balanceSubscriber{notify: make(chan struct{}, 1)}
+	for id := int64(1); id <= 100; id++ {
+		sub.push(BalanceEvent{ID: id})
+	}
+
+	ev, ok := sub.take()
+	if !ok || ev.ID != 100 {
+		t.Errorf("unspected event, want: 100, got: %d", ev.ID)
+	}
+	if _, ok := sub.take(); ok {
+		t.Errorf("unspected event after taking the latest")
+	}
+}
+
+func TestClientStreamBalance(t *testing.T) {
+	cfg := demoConfig()
+	cfg.Stream.Tick = Duration(10 * time.Millisecond)
+	srv := httptest.NewServer(newHandler(cfg))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	updates := NewClient(srv.URL).StreamBalance(ctx, "2")
+	var ids []string
+	for update := range updates {
+		if update.Err != nil {
+			t.Fatal(update.Err)
+		}
+		if update.Balance.UserID != 2 {
+			t.Errorf("unspected user, want: 2, got: %d", update.Balance.UserID)
+		}
+		if ids = append(ids, update.EventID); len(ids) == 3 {
+			cancel()
+		}
+	}
+
+	if len(ids) < 3 || ids[0] == ids[1] {
+		t.Errorf("unspected events, got: %v", ids)
+	}
+}
+
+func TestClientStreamBalanceRefused(t *testing.T) {
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+	auth := NewAuthenticator(demoKeys())
+	token, _ := auth.IssueToken("3", []string{scopeBalanceRead}, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithCredentials(BearerCredentials(token)))
+	updates := client.StreamBalance(ctx, "2")
+	update, ok := <-updates
+
+	var respErr *ResponseError
+	if !ok || !errors.As(update.Err, &respErr) || respErr.Status != http.StatusForbidden {
+		t.Errorf("unspected update, want a 403 error, got: %+v", update)
+	}
+	if _, ok := <-updates; ok {
+		t.Errorf("stream not closed after the server refused it")
+	}
+}
+
+func TestBalanceStreamSkipsFaults(t *testing.T) {
+	cfg := demoConfig()
+	cfg.Routes["balance"] = RouteConfig{TruncateRate: 1}
+	srv := httptest.NewServer(newHandler(cfg))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	update, ok := <-NewClient(srv.URL).StreamBalance(ctx, "2")
+
+	if !ok || update.Err != nil || update.Balance.UserID != 2 {
+		t.Errorf("unspected update, want the balance of user 2, got: %+v", update)
+	}
+}
+
+func TestBalanceBrokerDropsIdleFeeds(t *testing.T) {
+	broker := NewBalanceBroker(time.Millisecond)
+	broker.current(2)
+	sub, replay := broker.subscribe(2, 0, false)
+	broker.unsubscribe(2, sub)
+
+	broker.mu.Lock()
+	feeds := len(broker.feeds)
+	broker.mu.Unlock()
+	if feeds != 0 {
+		t.Errorf("unspected feeds, want: 0, got: %d", feeds)
+	}
+
+	_, resumed := broker.subscribe(2, replay[0].ID, true)
+	if len(resumed) != 1 || resumed[0].ID != replay[0].ID+1 {
+		t.Errorf("unspected replay after the feed was dropped, want ID %d, got: %+v", replay[0].ID+1, resumed)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+// WithTracer records a root GetUserStatus span for every fan-out, with a
+// client span for every call reaching an upstream, and passes its trace
+// context on in the traceparent header. Like WithMetrics it should be one
+// of the first options, so retries and hedges get a span each.
+func WithTracer(tracer tracing.Tracer) ClientOption {
+	return func(c *Client) {
+		c.tracer = tracer
+		c.fetch = traced(c.fetch, tracer)
+	}
+}
+
+// traced decorates fetch with a span per call, child of the span in the
+// request context.
+func traced(fetch fetchFunc, tracer tracing.Tracer) fetchFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		upstream := endpointOf(req.URL)
+		ctx, span := tracer.Start(req.Context(), req.Method+" "+upstream,
+			tracing.WithKind(tracing.KindClient),
+			tracing.WithAttributes(
+				tracing.Attr("http.request.method", req.Method),
+				tracing.Attr("url.full", req.URL.String()),
+				tracing.Attr("upstream", upstream),
+			),
+		)
+		defer span.End()
+
+		// the request may be sent again by retries and hedges, each call
+		// carries its own traceparent.
+		req = req.Clone(ctx)
+		tracing.Inject(ctx, req.Header)
+		resp, err := fetch(req)
+		if err != nil {
+			span.RecordError(err)
+			return resp, err
+		}
+		span.SetAttributes(tracing.Attr("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("%s answered %d", upstream, resp.StatusCode))
+		}
+		return resp, err
+	}
+}
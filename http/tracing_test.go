@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jegutierrez/functional_patterns_go/lifecycle"
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+// checkFanOut checks every upstream call of the root GetUserStatus span
+// was traced by the client, and by the server as its child.
+func checkFanOut(t *testing.T, spans []tracing.SpanData) {
+	t.Helper()
+	byName := map[string]tracing.SpanData{}
+	for _, s := range spans {
+		byName[s.Service+" "+s.Name] = s
+	}
+	root, ok := byName["client GetUserStatus"]
+	if !ok || root.Parent.IsValid() {
+		t.Fatalf("unspected root span, want: client GetUserStatus without parent, got: %+v", root)
+	}
+	for _, s := range spans {
+		if s.SpanContext.TraceID != root.SpanContext.TraceID {
+			t.Errorf("unspected trace of %s, want: %s, got: %s", s.Name, root.SpanContext.TraceID, s.SpanContext.TraceID)
+		}
+	}
+	for _, upstream := range []string{"users", "balance", "user-debts"} {
+		call, ok := byName["client GET "+upstream]
+		if !ok || call.Parent != root.SpanContext.SpanID || call.Kind != tracing.KindClient {
+			t.Errorf("unspected client span of %s, want child of the root, got: %+v", upstream, call)
+		}
+		served, ok := byName["server GET "+upstream]
+		if !ok || served.Parent != call.SpanContext.SpanID || served.Attribute("http.response.status_code") != 200 {
+			t.Errorf("unspected server span of %s, want child of the client call, got: %+v", upstream, served)
+		}
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	srv := httptest.NewServer(newManagedHandler(benchConfig(), lifecycle.New(), tracing.New("server", exporter)))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithTracer(tracing.New("client", exporter)))
+
+	if _, err := client.GetUserStatus(context.Background(), "2"); err != nil {
+		t.Fatal(err)
+	}
+	checkFanOut(t, exporter.Spans())
+}
+
+func TestUserStatusWaterfall(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	defaultTracer = tracing.New("server", exporter)
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+	defaultTracer = tracing.New("client", exporter)
+	defer func() { defaultTracer = tracing.Noop() }()
+
+	if _, err := GetUserStatusAsyncWaitGroup(srv.URL, "2"); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.Spans()
+	checkFanOut(t, spans)
+
+	var out strings.Builder
+	if err := tracing.WriteWaterfall(&out, spans, 40); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("\n" + out.String())
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if want := 1 + 1 + 3*2; len(lines) != want {
+		t.Fatalf("unspected lines, want: %d, got: %d\n%s", want, len(lines), out.String())
+	}
+	if !strings.HasPrefix(lines[1], "GetUserStatus [client]") {
+		t.Errorf("unspected first span, want: GetUserStatus [client], got: %s", lines[1])
+	}
+}
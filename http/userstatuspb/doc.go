@@ -0,0 +1,5 @@
+// Package userstatuspb holds the protobuf messages and gRPC service of the
+// user status API, generated from userstatus.proto.
+package userstatuspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative userstatus.proto
@@ -0,0 +1,390 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: userstatus.proto
+
+package userstatuspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UserRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserRequest) Reset() {
+	*x = UserRequest{}
+	mi := &file_userstatus_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserRequest) ProtoMessage() {}
+
+func (x *UserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_userstatus_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserRequest.ProtoReflect.Descriptor instead.
+func (*UserRequest) Descriptor() ([]byte, []int) {
+	return file_userstatus_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UserRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+type User struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_userstatus_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_userstatus_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_userstatus_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *User) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *User) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// Amounts are in cents.
+type Balance struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	AmountCents   int64                  `protobuf:"varint,2,opt,name=amount_cents,json=amountCents,proto3" json:"amount_cents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Balance) Reset() {
+	*x = Balance{}
+	mi := &file_userstatus_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Balance) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Balance) ProtoMessage() {}
+
+func (x *Balance) ProtoReflect() protoreflect.Message {
+	mi := &file_userstatus_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Balance.ProtoReflect.Descriptor instead.
+func (*Balance) Descriptor() ([]byte, []int) {
+	return file_userstatus_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Balance) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *Balance) GetAmountCents() int64 {
+	if x != nil {
+		return x.AmountCents
+	}
+	return 0
+}
+
+type Debt struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Reason        string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	AmountCents   int64                  `protobuf:"varint,3,opt,name=amount_cents,json=amountCents,proto3" json:"amount_cents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Debt) Reset() {
+	*x = Debt{}
+	mi := &file_userstatus_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Debt) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Debt) ProtoMessage() {}
+
+func (x *Debt) ProtoReflect() protoreflect.Message {
+	mi := &file_userstatus_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Debt.ProtoReflect.Descriptor instead.
+func (*Debt) Descriptor() ([]byte, []int) {
+	return file_userstatus_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Debt) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Debt) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Debt) GetAmountCents() int64 {
+	if x != nil {
+		return x.AmountCents
+	}
+	return 0
+}
+
+type UserStatus struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Id                 int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name               string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	BalanceAmountCents int64                  `protobuf:"varint,3,opt,name=balance_amount_cents,json=balanceAmountCents,proto3" json:"balance_amount_cents,omitempty"`
+	Debts              []*Debt                `protobuf:"bytes,4,rep,name=debts,proto3" json:"debts,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *UserStatus) Reset() {
+	*x = UserStatus{}
+	mi := &file_userstatus_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserStatus) ProtoMessage() {}
+
+func (x *UserStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_userstatus_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserStatus.ProtoReflect.Descriptor instead.
+func (*UserStatus) Descriptor() ([]byte, []int) {
+	return file_userstatus_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *UserStatus) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UserStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UserStatus) GetBalanceAmountCents() int64 {
+	if x != nil {
+		return x.BalanceAmountCents
+	}
+	return 0
+}
+
+func (x *UserStatus) GetDebts() []*Debt {
+	if x != nil {
+		return x.Debts
+	}
+	return nil
+}
+
+var File_userstatus_proto protoreflect.FileDescriptor
+
+const file_userstatus_proto_rawDesc = "" +
+	"\n" +
+	"\x10userstatus.proto\x12\ruserstatus.v1\"&\n" +
+	"\vUserRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\"*\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"E\n" +
+	"\aBalance\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\x12!\n" +
+	"\famount_cents\x18\x02 \x01(\x03R\vamountCents\"Q\n" +
+	"\x04Debt\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x12!\n" +
+	"\famount_cents\x18\x03 \x01(\x03R\vamountCents\"\x8d\x01\n" +
+	"\n" +
+	"UserStatus\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x120\n" +
+	"\x14balance_amount_cents\x18\x03 \x01(\x03R\x12balanceAmountCents\x12)\n" +
+	"\x05debts\x18\x04 \x03(\v2\x13.userstatus.v1.DebtR\x05debts2\x99\x02\n" +
+	"\x11UserStatusService\x12:\n" +
+	"\aGetUser\x12\x1a.userstatus.v1.UserRequest\x1a\x13.userstatus.v1.User\x12@\n" +
+	"\n" +
+	"GetBalance\x12\x1a.userstatus.v1.UserRequest\x1a\x16.userstatus.v1.Balance\x12>\n" +
+	"\tListDebts\x12\x1a.userstatus.v1.UserRequest\x1a\x13.userstatus.v1.Debt0\x01\x12F\n" +
+	"\rGetUserStatus\x12\x1a.userstatus.v1.UserRequest\x1a\x19.userstatus.v1.UserStatusBAZ?github.com/jegutierrez/functional_patterns_go/http/userstatuspbb\x06proto3"
+
+var (
+	file_userstatus_proto_rawDescOnce sync.Once
+	file_userstatus_proto_rawDescData []byte
+)
+
+func file_userstatus_proto_rawDescGZIP() []byte {
+	file_userstatus_proto_rawDescOnce.Do(func() {
+		file_userstatus_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_userstatus_proto_rawDesc), len(file_userstatus_proto_rawDesc)))
+	})
+	return file_userstatus_proto_rawDescData
+}
+
+var file_userstatus_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_userstatus_proto_goTypes = []any{
+	(*UserRequest)(nil), // 0: userstatus.v1.UserRequest
+	(*User)(nil),        // 1: userstatus.v1.User
+	(*Balance)(nil),     // 2: userstatus.v1.Balance
+	(*Debt)(nil),        // 3: userstatus.v1.Debt
+	(*UserStatus)(nil),  // 4: userstatus.v1.UserStatus
+}
+var file_userstatus_proto_depIdxs = []int32{
+	3, // 0: userstatus.v1.UserStatus.debts:type_name -> userstatus.v1.Debt
+	0, // 1: userstatus.v1.UserStatusService.GetUser:input_type -> userstatus.v1.UserRequest
+	0, // 2: userstatus.v1.UserStatusService.GetBalance:input_type -> userstatus.v1.UserRequest
+	0, // 3: userstatus.v1.UserStatusService.ListDebts:input_type -> userstatus.v1.UserRequest
+	0, // 4: userstatus.v1.UserStatusService.GetUserStatus:input_type -> userstatus.v1.UserRequest
+	1, // 5: userstatus.v1.UserStatusService.GetUser:output_type -> userstatus.v1.User
+	2, // 6: userstatus.v1.UserStatusService.GetBalance:output_type -> userstatus.v1.Balance
+	3, // 7: userstatus.v1.UserStatusService.ListDebts:output_type -> userstatus.v1.Debt
+	4, // 8: userstatus.v1.UserStatusService.GetUserStatus:output_type -> userstatus.v1.UserStatus
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_userstatus_proto_init() }
+func file_userstatus_proto_init() {
+	if File_userstatus_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_userstatus_proto_rawDesc), len(file_userstatus_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_userstatus_proto_goTypes,
+		DependencyIndexes: file_userstatus_proto_depIdxs,
+		MessageInfos:      file_userstatus_proto_msgTypes,
+	}.Build()
+	File_userstatus_proto = out.File
+	file_userstatus_proto_goTypes = nil
+	file_userstatus_proto_depIdxs = nil
+}
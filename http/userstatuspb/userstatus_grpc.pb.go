@@ -0,0 +1,247 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: userstatus.proto
+
+package userstatuspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	UserStatusService_GetUser_FullMethodName       = "/userstatus.v1.UserStatusService/GetUser"
+	UserStatusService_GetBalance_FullMethodName    = "/userstatus.v1.UserStatusService/GetBalance"
+	UserStatusService_ListDebts_FullMethodName     = "/userstatus.v1.UserStatusService/ListDebts"
+	UserStatusService_GetUserStatus_FullMethodName = "/userstatus.v1.UserStatusService/GetUserStatus"
+)
+
+// UserStatusServiceClient is the client API for UserStatusService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// UserStatusService mirrors the user, balance and debts HTTP API.
+type UserStatusServiceClient interface {
+	GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error)
+	GetBalance(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Balance, error)
+	// ListDebts streams the debts of a user one by one.
+	ListDebts(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Debt], error)
+	// GetUserStatus joins the user, balance and debts on the server.
+	GetUserStatus(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*UserStatus, error)
+}
+
+type userStatusServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUserStatusServiceClient(cc grpc.ClientConnInterface) UserStatusServiceClient {
+	return &userStatusServiceClient{cc}
+}
+
+func (c *userStatusServiceClient) GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, UserStatusService_GetUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userStatusServiceClient) GetBalance(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Balance, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Balance)
+	err := c.cc.Invoke(ctx, UserStatusService_GetBalance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userStatusServiceClient) ListDebts(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Debt], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserStatusService_ServiceDesc.Streams[0], UserStatusService_ListDebts_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UserRequest, Debt]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserStatusService_ListDebtsClient = grpc.ServerStreamingClient[Debt]
+
+func (c *userStatusServiceClient) GetUserStatus(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*UserStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserStatus)
+	err := c.cc.Invoke(ctx, UserStatusService_GetUserStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UserStatusServiceServer is the server API for UserStatusService service.
+// All implementations must embed UnimplementedUserStatusServiceServer
+// for forward compatibility.
+//
+// UserStatusService mirrors the user, balance and debts HTTP API.
+type UserStatusServiceServer interface {
+	GetUser(context.Context, *UserRequest) (*User, error)
+	GetBalance(context.Context, *UserRequest) (*Balance, error)
+	// ListDebts streams the debts of a user one by one.
+	ListDebts(*UserRequest, grpc.ServerStreamingServer[Debt]) error
+	// GetUserStatus joins the user, balance and debts on the server.
+	GetUserStatus(context.Context, *UserRequest) (*UserStatus, error)
+	mustEmbedUnimplementedUserStatusServiceServer()
+}
+
+// UnimplementedUserStatusServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUserStatusServiceServer struct{}
+
+func (UnimplementedUserStatusServiceServer) GetUser(context.Context, *UserRequest) (*User, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedUserStatusServiceServer) GetBalance(context.Context, *UserRequest) (*Balance, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedUserStatusServiceServer) ListDebts(*UserRequest, grpc.ServerStreamingServer[Debt]) error {
+	return status.Error(codes.Unimplemented, "method ListDebts not implemented")
+}
+func (UnimplementedUserStatusServiceServer) GetUserStatus(context.Context, *UserRequest) (*UserStatus, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetUserStatus not implemented")
+}
+func (UnimplementedUserStatusServiceServer) mustEmbedUnimplementedUserStatusServiceServer() {}
+func (UnimplementedUserStatusServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeUserStatusServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UserStatusServiceServer will
+// result in compilation errors.
+type UnsafeUserStatusServiceServer interface {
+	mustEmbedUnimplementedUserStatusServiceServer()
+}
+
+func RegisterUserStatusServiceServer(s grpc.ServiceRegistrar, srv UserStatusServiceServer) {
+	// If the following call panics, it indicates UnimplementedUserStatusServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&UserStatusService_ServiceDesc, srv)
+}
+
+func _UserStatusService_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserStatusServiceServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserStatusService_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserStatusServiceServer).GetUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserStatusService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserStatusServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserStatusService_GetBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserStatusServiceServer).GetBalance(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserStatusService_ListDebts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(UserRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UserStatusServiceServer).ListDebts(m, &grpc.GenericServerStream[UserRequest, Debt]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserStatusService_ListDebtsServer = grpc.ServerStreamingServer[Debt]
+
+func _UserStatusService_GetUserStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserStatusServiceServer).GetUserStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserStatusService_GetUserStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserStatusServiceServer).GetUserStatus(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UserStatusService_ServiceDesc is the grpc.ServiceDesc for UserStatusService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UserStatusService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "userstatus.v1.UserStatusService",
+	HandlerType: (*UserStatusServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUser",
+			Handler:    _UserStatusService_GetUser_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _UserStatusService_GetBalance_Handler,
+		},
+		{
+			MethodName: "GetUserStatus",
+			Handler:    _UserStatusService_GetUserStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListDebts",
+			Handler:       _UserStatusService_ListDebts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "userstatus.proto",
+}
@@ -0,0 +1,159 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status of a check or of a whole report.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check reports whether a dependency works. It gets a context bounded by
+// the check timeout.
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of a check, latency is how long it took when
+// it last ran.
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Cached    bool    `json:"cached,omitempty"`
+}
+
+// Report is the JSON body of the health endpoints, failing when any of its
+// checks fails.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Checks is a registry of named checks. They run concurrently, each one
+// bounded by a timeout, and their results are cached for a while so
+// frequent probes don't load the dependencies.
+type Checks struct {
+	timeout time.Duration
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	checks []*namedCheck
+}
+
+// namedCheck keeps the last result of a check. Its lock makes concurrent
+// probes wait for a single run.
+type namedCheck struct {
+	name  string
+	check Check
+
+	mu   sync.Mutex
+	last CheckResult
+	at   time.Time
+}
+
+// NewChecks runs each check for up to timeout and reuses its result for ttl.
+func NewChecks(timeout, ttl time.Duration) *Checks {
+	return &Checks{timeout: timeout, ttl: ttl, now: time.Now}
+}
+
+// Register adds a check, replacing the one with the same name.
+func (c *Checks) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, nc := range c.checks {
+		if nc.name == name {
+			c.checks[i] = &namedCheck{name: name, check: check}
+			return
+		}
+	}
+	c.checks = append(c.checks, &namedCheck{name: name, check: check})
+}
+
+// Run returns the results of the checks in the order they were registered.
+func (c *Checks) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]*namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	report := Report{Status: StatusOK, Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, nc)
+		}()
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checks) run(ctx context.Context, nc *namedCheck) CheckResult {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if !nc.at.IsZero() && c.now().Sub(nc.at) < c.ttl {
+		result := nc.last
+		result.Cached = true
+		return result
+	}
+
+	// the result is shared by later probes, so it must not depend on the
+	// request that happened to run it.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	start := c.now()
+	go func() { done <- nc.check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+
+	nc.at = c.now()
+	nc.last = CheckResult{
+		Name:      nc.name,
+		Status:    StatusOK,
+		LatencyMS: float64(nc.at.Sub(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		nc.last.Status = StatusFail
+		nc.last.Error = err.Error()
+	}
+	return nc.last
+}
+
+// reportHandler answers the report of checks, preceded by the state of
+// the manager, with 503 when anything fails.
+func reportHandler(state func() bool, down string, checks *Checks) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checks.Run(r.Context())
+		lifecycle := CheckResult{Name: "lifecycle", Status: StatusOK}
+		if !state() {
+			lifecycle.Status, lifecycle.Error = StatusFail, down
+			report.Status = StatusFail
+		}
+		report.Checks = append([]CheckResult{lifecycle}, report.Checks...)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,124 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChecksRunConcurrently(t *testing.T) {
+	checks := NewChecks(time.Second, 0)
+	for _, name := range []string{"store", "cache", "queue"} {
+		checks.Register(name, func(context.Context) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})
+	}
+
+	start := time.Now()
+	report := checks.Run(context.Background())
+
+	if elapsed := time.Since(start); elapsed > 120*time.Millisecond {
+		t.Errorf("unspected latency, want checks run concurrently, got: %s", elapsed)
+	}
+	if report.Status != StatusOK || len(report.Checks) != 3 || report.Checks[0].Name != "store" {
+		t.Errorf("unspected report, got: %+v", report)
+	}
+	if report.Checks[0].LatencyMS < 50 {
+		t.Errorf("unspected latency, want: >= 50ms, got: %vms", report.Checks[0].LatencyMS)
+	}
+}
+
+func TestChecksTimeout(t *testing.T) {
+	checks := NewChecks(20*time.Millisecond, 0)
+	checks.Register("stuck", func(context.Context) error {
+		select {}
+	})
+	checks.Register("store", func(context.Context) error {
+		return nil
+	})
+
+	report := checks.Run(context.Background())
+
+	if report.Status != StatusFail {
+		t.Errorf("unspected status, want: %s, got: %s", StatusFail, report.Status)
+	}
+	if got := report.Checks[0]; got.Status != StatusFail || got.Error != "timed out after 20ms" {
+		t.Errorf("unspected result, want a timeout, got: %+v", got)
+	}
+	if got := report.Checks[1]; got.Status != StatusOK {
+		t.Errorf("unspected result, want: %s, got: %+v", StatusOK, got)
+	}
+}
+
+func TestChecksCache(t *testing.T) {
+	now := time.Now()
+	checks := NewChecks(time.Second, time.Second)
+	checks.now = func() time.Time { return now }
+	var runs atomic.Int32
+	checks.Register("store", func(context.Context) error {
+		runs.Add(1)
+		return errors.New("unreachable")
+	})
+
+	tt := []struct {
+		name       string
+		after      time.Duration
+		wantRuns   int32
+		wantCached bool
+	}{
+		{"first probe", 0, 1, false},
+		{"within ttl", 500 * time.Millisecond, 1, true},
+		{"after ttl", time.Second, 2, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.after)
+			got := checks.Run(context.Background()).Checks[0]
+
+			if runs.Load() != tc.wantRuns || got.Cached != tc.wantCached {
+				t.Errorf("unspected result, want: %d runs and cached %v, got: %d runs and %+v", tc.wantRuns, tc.wantCached, runs.Load(), got)
+			}
+			if got.Error != "unreachable" {
+				t.Errorf("unspected error, want: unreachable, got: %q", got.Error)
+			}
+		})
+	}
+}
+
+func TestReadinessReport(t *testing.T) {
+	m := New(quiet())
+	m.ready.Store(true)
+	m.AddReadinessCheck("config", func(context.Context) error { return nil })
+	m.AddReadinessCheck("store", func(context.Context) error { return errors.New("connection refused") })
+
+	rr := httptest.NewRecorder()
+	m.ReadinessHandler()(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("unspected status, want: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	var report Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	want := []CheckResult{
+		{Name: "lifecycle", Status: StatusOK},
+		{Name: "config", Status: StatusOK},
+		{Name: "store", Status: StatusFail, Error: "connection refused"},
+	}
+	if report.Status != StatusFail || len(report.Checks) != len(want) {
+		t.Fatalf("unspected report, got: %+v", report)
+	}
+	for i, got := range report.Checks {
+		got.LatencyMS = 0
+		if got != want[i] {
+			t.Errorf("unspected check, want: %+v, got: %+v", want[i], got)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package lifecycle runs servers until the process is asked to stop, then
+// drains them gracefully and closes their dependencies.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithDrainTimeout sets how long in-flight requests may take to finish once
+// shutdown starts. Connections still open after it are closed.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.drainTimeout = d
+	}
+}
+
+// WithShutdownDelay keeps serving for d after the manager turned not ready,
+// so load balancers polling the readiness endpoint stop sending traffic
+// before the listeners close.
+func WithShutdownDelay(d time.Duration) Option {
+	return func(m *Manager) {
+		m.shutdownDelay = d
+	}
+}
+
+// WithSignals sets the signals that start the shutdown, SIGINT and SIGTERM
+// by default.
+func WithSignals(signals ...os.Signal) Option {
+	return func(m *Manager) {
+		m.signals = signals
+	}
+}
+
+// WithLogger logs the lifecycle events to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+// WithCheckTimeout bounds how long each health check may take, one second
+// by default.
+func WithCheckTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.checkTimeout = d
+	}
+}
+
+// WithCheckCacheTTL sets for how long the result of a health check is
+// reused, one second by default.
+func WithCheckCacheTTL(d time.Duration) Option {
+	return func(m *Manager) {
+		m.checkTTL = d
+	}
+}
+
+// Unmanaged marks the manager ready from the start, for handlers served by
+// someone else than Run, such as test servers.
+func Unmanaged() Option {
+	return func(m *Manager) {
+		m.ready.Store(true)
+	}
+}
+
+// service is something the manager starts and stops, such as a server.
+type service struct {
+	name string
+	run  func() error
+	stop func(ctx context.Context) error
+}
+
+// hook is a function run during shutdown.
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager runs services until a signal arrives or one of them fails, then
+// shuts them down:
+//
+//  1. readiness turns false, and the manager waits for the shutdown delay
+//  2. the drain hooks run, to end long-lived streams
+//  3. services stop taking new work and finish the in-flight one, up to the
+//     drain timeout
+//  4. liveness turns false and the close hooks run in reverse order, to
+//     close stores, tracers and the like
+type Manager struct {
+	drainTimeout  time.Duration
+	shutdownDelay time.Duration
+	signals       []os.Signal
+	logger        *slog.Logger
+	checkTimeout  time.Duration
+	checkTTL      time.Duration
+
+	ready    atomic.Bool
+	live     atomic.Bool
+	stopOnce sync.Once
+	stopping chan struct{}
+
+	mu       sync.Mutex
+	services []service
+	onDrain  []hook
+	onClose  []hook
+
+	liveness  *Checks
+	readiness *Checks
+}
+
+// New creates a manager draining for up to 15 seconds on SIGINT or SIGTERM.
+func New(opts ...Option) *Manager {
+	m := &Manager{
+		drainTimeout: 15 * time.Second,
+		signals:      []os.Signal{os.Interrupt, syscall.SIGTERM},
+		logger:       slog.Default(),
+		stopping:     make(chan struct{}),
+		checkTimeout: time.Second,
+		checkTTL:     time.Second,
+	}
+	m.live.Store(true)
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.liveness = NewChecks(m.checkTimeout, m.checkTTL)
+	m.readiness = NewChecks(m.checkTimeout, m.checkTTL)
+	return m
+}
+
+// Add runs a service: run blocks while it serves and stop makes it finish
+// the in-flight work and return.
+func (m *Manager) Add(name string, run func() error, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.services = append(m.services, service{name: name, run: run, stop: stop})
+}
+
+// AddServer runs srv with ListenAndServe, or ListenAndServeTLS when both
+// files are set.
+func (m *Manager) AddServer(srv *http.Server, certFile, keyFile string) {
+	run := srv.ListenAndServe
+	if certFile != "" && keyFile != "" {
+		run = func() error { return srv.ListenAndServeTLS(certFile, keyFile) }
+	}
+	m.Add("http "+srv.Addr, func() error {
+		if err := run(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, func(ctx context.Context) error {
+		err := srv.Shutdown(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// drop the connections that didn't finish in time.
+			srv.Close()
+		}
+		return err
+	})
+}
+
+// OnDrain runs fn as soon as the shutdown starts, before waiting for
+// in-flight requests. Streams and other long-lived connections use it to
+// end, as draining waits for them otherwise.
+func (m *Manager) OnDrain(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onDrain = append(m.onDrain, hook{name: name, fn: fn})
+}
+
+// OnClose runs fn once services are stopped, in the reverse order hooks
+// were added, to close the dependencies of the services.
+func (m *Manager) OnClose(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onClose = append(m.onClose, hook{name: name, fn: fn})
+}
+
+// AddLivenessCheck reports check on the liveness endpoint. Only checks the
+// process can't recover from without a restart belong here.
+func (m *Manager) AddLivenessCheck(name string, check Check) {
+	m.liveness.Register(name, check)
+}
+
+// AddReadinessCheck reports check on the readiness endpoint, taking the
+// instance out of rotation while a dependency fails.
+func (m *Manager) AddReadinessCheck(name string, check Check) {
+	m.readiness.Register(name, check)
+}
+
+// Ready reports whether the services are running and not shutting down.
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
+// Live reports whether the process works, it turns false once services
+// are stopped.
+func (m *Manager) Live() bool {
+	return m.live.Load()
+}
+
+// Stopping is closed when the shutdown starts.
+func (m *Manager) Stopping() <-chan struct{} {
+	return m.stopping
+}
+
+// Shutdown starts the shutdown as a signal would.
+func (m *Manager) Shutdown() {
+	m.stopOnce.Do(func() { close(m.stopping) })
+}
+
+// Run starts the services and blocks until they are shut down, because of
+// a signal, a call to Shutdown, ctx being done or a service failing. It
+// returns the errors of the services and hooks.
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, m.signals...)
+	defer stop()
+
+	m.mu.Lock()
+	services := append([]service(nil), m.services...)
+	m.mu.Unlock()
+
+	failed := make(chan error, len(services))
+	var running sync.WaitGroup
+	for _, s := range services {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			if err := s.run(); err != nil {
+				failed <- fmt.Errorf("%s: %w", s.name, err)
+			}
+		}()
+	}
+	m.ready.Store(true)
+	logger := m.logger.With("component", "lifecycle")
+	logger.Info("running services", "services", len(services))
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		logger.Info("shutdown requested")
+	case <-m.stopping:
+		logger.Info("shutdown requested")
+	case err := <-failed:
+		logger.Error("service failed", "error", err)
+		errs = append(errs, err)
+	}
+	m.Shutdown()
+	m.ready.Store(false)
+	time.Sleep(m.shutdownDelay)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), m.drainTimeout)
+	defer cancel()
+	errs = append(errs, m.runHooks(drainCtx, m.onDrain, false)...)
+	var stopping sync.WaitGroup
+	var mu sync.Mutex
+	for _, s := range services {
+		stopping.Add(1)
+		go func() {
+			defer stopping.Done()
+			if err := s.stop(drainCtx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("stopping %s: %w", s.name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	stopping.Wait()
+	running.Wait()
+	m.live.Store(false)
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), m.drainTimeout)
+	defer cancelClose()
+	errs = append(errs, m.runHooks(closeCtx, m.onClose, true)...)
+	logger.Info("stopped")
+	return errors.Join(errs...)
+}
+
+func (m *Manager) runHooks(ctx context.Context, hooks []hook, reverse bool) []error {
+	m.mu.Lock()
+	hooks = append([]hook(nil), hooks...)
+	m.mu.Unlock()
+
+	var errs []error
+	for i := range hooks {
+		h := hooks[i]
+		if reverse {
+			h = hooks[len(hooks)-1-i]
+		}
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+		}
+	}
+	return errs
+}
+
+// LivenessHandler answers the report of the liveness checks, with 503 when
+// one fails or the process stopped.
+func (m *Manager) LivenessHandler() http.HandlerFunc {
+	return reportHandler(m.Live, "stopped", m.liveness)
+}
+
+// ReadinessHandler answers the report of the readiness checks, with 503
+// when one fails or the shutdown started, so load balancers take the
+// instance out of rotation.
+func (m *Manager) ReadinessHandler() http.HandlerFunc {
+	return reportHandler(m.Ready, "not ready", m.readiness)
+}
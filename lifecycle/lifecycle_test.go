@@ -0,0 +1,222 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func quiet() Option {
+	return WithLogger(slog.New(slog.DiscardHandler))
+}
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// run starts m and returns the result of Run once it returns.
+func run(m *Manager) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- m.Run(context.Background()) }()
+	return done
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	addr := freeAddr(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	m := New(quiet())
+	m.AddServer(&http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})}, "", "")
+	done := run(m)
+	waitUntil(t, m.Ready)
+
+	status := make(chan int, 1)
+	go func() {
+		res, err := http.Get("http://" + addr)
+		if err != nil {
+			status <- 0
+			return
+		}
+		res.Body.Close()
+		status <- res.StatusCode
+	}()
+	<-started
+
+	m.Shutdown()
+	waitUntil(t, func() bool { return !m.Ready() })
+	if !m.Live() {
+		t.Errorf("unspected liveness while draining, want: true, got: false")
+	}
+	close(release)
+
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("unspected status of the in-flight request, want: %d, got: %d", http.StatusOK, got)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("unspected error, want: nil, got: %v", err)
+	}
+	if m.Live() {
+		t.Errorf("unspected liveness after shutdown, want: false, got: true")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	addr := freeAddr(t)
+	started := make(chan struct{})
+	m := New(quiet(), WithDrainTimeout(50*time.Millisecond))
+	m.AddServer(&http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})}, "", "")
+	done := run(m)
+	waitUntil(t, m.Ready)
+
+	go http.Get("http://" + addr)
+	<-started
+	m.Shutdown()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("unspected error, want: %v, got: %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown didn't stop at the drain deadline")
+	}
+}
+
+func TestShutdownHooksOrder(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, event)
+	}
+	hook := func(event string) func(context.Context) error {
+		return func(context.Context) error {
+			record(event)
+			return nil
+		}
+	}
+
+	stop := make(chan struct{})
+	m := New(quiet())
+	m.Add("worker", func() error {
+		<-stop
+		return nil
+	}, func(context.Context) error {
+		record("stop worker")
+		close(stop)
+		return nil
+	})
+	m.OnDrain("streams", hook("drain streams"))
+	m.OnClose("store", hook("close store"))
+	m.OnClose("tracer", hook("close tracer"))
+
+	done := run(m)
+	waitUntil(t, m.Ready)
+	m.Shutdown()
+	if err := <-done; err != nil {
+		t.Fatalf("unspected error, want: nil, got: %v", err)
+	}
+
+	want := []string{"drain streams", "stop worker", "close tracer", "close store"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("unspected order, want: %v, got: %v", want, got)
+	}
+}
+
+func TestServiceFailureShutsDown(t *testing.T) {
+	failure := errors.New("listen failed")
+	closed := false
+	m := New(quiet())
+	m.Add("broken", func() error {
+		return failure
+	}, func(context.Context) error {
+		return nil
+	})
+	m.OnClose("store", func(context.Context) error {
+		closed = true
+		return nil
+	})
+
+	if err := m.Run(context.Background()); !errors.Is(err, failure) {
+		t.Errorf("unspected error, want: %v, got: %v", failure, err)
+	}
+	if !closed {
+		t.Errorf("unspected result, want: store closed, got: still open")
+	}
+}
+
+func TestProbes(t *testing.T) {
+	m := New(quiet())
+	tests := []struct {
+		name       string
+		ready      bool
+		live       bool
+		readyzCode int
+		healthCode int
+	}{
+		{"starting", false, true, http.StatusServiceUnavailable, http.StatusOK},
+		{"running", true, true, http.StatusOK, http.StatusOK},
+		{"stopped", false, false, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.ready.Store(tt.ready)
+			m.live.Store(tt.live)
+			for _, probe := range []struct {
+				h    http.HandlerFunc
+				want int
+			}{
+				{m.ReadinessHandler(), tt.readyzCode},
+				{m.LivenessHandler(), tt.healthCode},
+			} {
+				rr := httptest.NewRecorder()
+				probe.h(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rr.Code != probe.want {
+					t.Errorf("unspected status, want: %d, got: %d", probe.want, rr.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestUnmanagedReady(t *testing.T) {
+	if !New(quiet(), Unmanaged()).Ready() {
+		t.Errorf("unspected readiness, want: ready, got: not ready")
+	}
+	if New(quiet()).Ready() {
+		t.Errorf("unspected readiness before Run, want: not ready, got: ready")
+	}
+}
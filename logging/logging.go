@@ -0,0 +1,72 @@
+// Package logging builds structured loggers and carries them in the
+// context of a request, so every line logged while serving it shares the
+// request's fields.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+// New creates a logger writing lines as "text" (the default) or "json" to
+// w, from level on, e.g. "debug", "info", "warn" or "error".
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("log level: %w", err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want text or json", format)
+	}
+}
+
+// holder is shared by a context and all the contexts derived from it, so
+// fields added deep in a request reach the lines logged further out.
+type holder struct {
+	logger atomic.Pointer[slog.Logger]
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	h := &holder{}
+	h.logger.Store(logger)
+	return context.WithValue(ctx, loggerKey{}, h)
+}
+
+// FromContext returns the logger in ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if h, ok := ctx.Value(loggerKey{}).(*holder); ok {
+		return h.logger.Load()
+	}
+	return slog.Default()
+}
+
+// With adds fields, as alternating keys and values or slog.Attrs, to the
+// logger in ctx. They are logged in every later line of the contexts
+// sharing it, including the ones of middleware further out such as the
+// access log. Without a logger in ctx it does nothing.
+func With(ctx context.Context, args ...any) {
+	h, ok := ctx.Value(loggerKey{}).(*holder)
+	if !ok {
+		return
+	}
+	for {
+		old := h.logger.Load()
+		if h.logger.CompareAndSwap(old, old.With(args...)) {
+			return
+		}
+	}
+}
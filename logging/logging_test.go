@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tt := []struct {
+		name   string
+		format string
+		level  string
+		want   string
+	}{
+		{name: "text by default", want: "level=INFO msg=hello user_id=2\n"},
+		{name: "json", format: "json", want: `{"level":"INFO","msg":"hello","user_id":2}` + "\n"},
+		{name: "above the level", level: "warn", want: ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			logger, err := New(&out, tc.format, tc.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// without time, so lines can be compared.
+			logger = slog.New(withoutTime{logger.Handler()})
+			logger.Info("hello", "user_id", 2)
+			if out.String() != tc.want {
+				t.Errorf("unspected result, want: %q, got: %q", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, args := range [][2]string{{"xml", ""}, {"", "loud"}} {
+		if _, err := New(&strings.Builder{}, args[0], args[1]); err == nil {
+			t.Errorf("unspected result for %v, want error, got nil", args)
+		}
+	}
+}
+
+func TestWithReachesOuterContexts(t *testing.T) {
+	var out strings.Builder
+	logger, _ := New(&out, "json", "")
+	ctx := NewContext(context.Background(), logger.With("request_id", "abc"))
+	inner, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	With(inner, "route", "balance")
+	FromContext(ctx).Info("request")
+
+	var line map[string]any
+	if err := json.Unmarshal([]byte(out.String()), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["request_id"] != "abc" || line["route"] != "balance" {
+		t.Errorf("unspected fields, want: request_id and route, got: %v", line)
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	With(context.Background(), "ignored", true)
+	if FromContext(context.Background()) != slog.Default() {
+		t.Errorf("unspected logger, want the default one")
+	}
+}
+
+// withoutTime drops the time of records, handlers leave zero times out.
+type withoutTime struct{ slog.Handler }
+
+func (h withoutTime) Handle(ctx context.Context, r slog.Record) error {
+	r.Time = time.Time{}
+	return h.Handler.Handle(ctx, r)
+}
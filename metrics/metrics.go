@@ -0,0 +1,328 @@
+// Package metrics keeps counters, gauges and histograms labeled by name,
+// and writes them in the Prometheus text format so any scraper can read
+// them without a client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds the metric families exposed together on an endpoint.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+// family is a metric with all its labeled series.
+type family interface {
+	write(w io.Writer)
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]family{}}
+}
+
+// register returns the family already registered as name, so the same
+// metric may be asked for by every component using it, or adds f.
+func register[F family](r *Registry, name string, f F) F {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.families[name]; ok {
+		if same, ok := existing.(F); ok {
+			return same
+		}
+		panic(fmt.Sprintf("metrics: %s registered with another type", name))
+	}
+	r.families[name] = f
+	return f
+}
+
+// Counter returns the counter vector name, creating it on first use.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return register(r, name, &CounterVec{newVec(name, help, "counter", labels, func() *Counter { return &Counter{} })})
+}
+
+// Gauge returns the gauge vector name, creating it on first use.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return register(r, name, &GaugeVec{newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })})
+}
+
+// Histogram returns the histogram vector name with the given upper bounds,
+// creating it on first use.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return register(r, name, &HistogramVec{newVec(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	})})
+}
+
+// WriteText writes every family sorted by name in the Prometheus text
+// exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		families[i] = r.families[name]
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry, as /metrics.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	}
+}
+
+// series is a metric with a fixed set of label values.
+type series interface {
+	samples(name, labels string) []sample
+}
+
+type sample struct {
+	name   string
+	labels string
+	value  float64
+}
+
+// vec keeps the series of a family keyed by their label values.
+type vec[S series] struct {
+	name, help, typ string
+	labels          []string
+	newSeries       func() S
+
+	mu     sync.Mutex
+	series map[string]S
+	values map[string][]string
+}
+
+func newVec[S series](name, help, typ string, labels []string, newSeries func() S) *vec[S] {
+	return &vec[S]{
+		name:      name,
+		help:      help,
+		typ:       typ,
+		labels:    labels,
+		newSeries: newSeries,
+		series:    map[string]S{},
+		values:    map[string][]string{},
+	}
+}
+
+func (v *vec[S]) with(values []string) S {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = v.newSeries()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+func (v *vec[S]) write(w io.Writer) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var samples []sample
+	for _, key := range keys {
+		samples = append(samples, v.series[key].samples(v.name, formatLabels(v.labels, v.values[key]))...)
+	}
+	v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escape(v.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+	for _, s := range samples {
+		if s.labels == "" {
+			fmt.Fprintf(w, "%s %s\n", s.name, formatValue(s.value))
+		} else {
+			fmt.Fprintf(w, "%s{%s} %s\n", s.name, s.labels, formatValue(s.value))
+		}
+	}
+}
+
+// CounterVec is a family of counters.
+type CounterVec struct{ *vec[*Counter] }
+
+// With returns the counter of the label values, in the order of the labels.
+func (v *CounterVec) With(values ...string) *Counter { return v.with(values) }
+
+// GaugeVec is a family of gauges.
+type GaugeVec struct{ *vec[*Gauge] }
+
+// With returns the gauge of the label values, in the order of the labels.
+func (v *GaugeVec) With(values ...string) *Gauge { return v.with(values) }
+
+// HistogramVec is a family of histograms.
+type HistogramVec struct{ *vec[*Histogram] }
+
+// With returns the histogram of the label values, in the order of the labels.
+func (v *HistogramVec) With(values ...string) *Histogram { return v.with(values) }
+
+// Counter only goes up.
+type Counter struct{ value atomicFloat }
+
+// Inc adds one.
+func (c *Counter) Inc() { c.value.add(1) }
+
+// Add adds d, which must not be negative.
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		panic("metrics: counters can't decrease")
+	}
+	c.value.add(d)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() float64 { return c.value.load() }
+
+func (c *Counter) samples(name, labels string) []sample {
+	return []sample{{name, labels, c.Value()}}
+}
+
+// Gauge goes up and down.
+type Gauge struct{ value atomicFloat }
+
+// Set replaces the value.
+func (g *Gauge) Set(v float64) { g.value.bits.Store(math.Float64bits(v)) }
+
+// Inc adds one.
+func (g *Gauge) Inc() { g.value.add(1) }
+
+// Dec subtracts one.
+func (g *Gauge) Dec() { g.value.add(-1) }
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 { return g.value.load() }
+
+func (g *Gauge) samples(name, labels string) []sample {
+	return []sample{{name, labels, g.Value()}}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe records v.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns how many values were observed.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) samples(name, labels string) []sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	samples := make([]sample, 0, len(h.buckets)+3)
+	for i, bound := range h.buckets {
+		samples = append(samples, sample{name + "_bucket", labels + sep + `le="` + formatValue(bound) + `"`, float64(h.counts[i])})
+	}
+	samples = append(samples,
+		sample{name + "_bucket", labels + sep + `le="+Inf"`, float64(h.count)},
+		sample{name + "_sum", labels, h.sum},
+		sample{name + "_count", labels, float64(h.count)},
+	)
+	return samples
+}
+
+// atomicFloat is a float64 updated without locks.
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (f *atomicFloat) add(d float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+d)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escape(values[i], true) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// escape escapes backslashes and new lines, and double quotes in label
+// values.
+func escape(s string, quotes bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if quotes {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+	return r.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
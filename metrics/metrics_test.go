@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.Counter("requests_total", "Requests served.", "route", "code")
+	requests.With("users", "200").Add(3)
+	requests.With("balance", "500").Inc()
+	reg.Gauge("in_flight", "Requests being served.").With().Set(2)
+	latency := reg.Histogram("latency_seconds", "Request latency.", []float64{0.5, 0.1}, "route")
+	latency.With("users").Observe(0.05)
+	latency.With("users").Observe(0.3)
+	latency.With("users").Observe(2)
+
+	var out strings.Builder
+	if err := reg.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP in_flight Requests being served.
+# TYPE in_flight gauge
+in_flight 2
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="users",le="0.1"} 1
+latency_seconds_bucket{route="users",le="0.5"} 2
+latency_seconds_bucket{route="users",le="+Inf"} 3
+latency_seconds_sum{route="users"} 2.35
+latency_seconds_count{route="users"} 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="balance",code="500"} 1
+requests_total{route="users",code="200"} 3
+`
+	if out.String() != want {
+		t.Errorf("unspected output, want:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("errors_total", "Errors by message.", "message").With("bad \"id\"\nat C:\\").Inc()
+
+	var out strings.Builder
+	reg.WriteText(&out)
+
+	want := `errors_total{message="bad \"id\"\nat C:\\"} 1`
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("unspected output, want line: %s, got:\n%s", want, out.String())
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("calls_total", "Calls.", "upstream").With("users").Inc()
+	reg.Counter("calls_total", "Calls.", "upstream").With("users").Inc()
+
+	if got := reg.Counter("calls_total", "Calls.", "upstream").With("users").Value(); got != 2 {
+		t.Errorf("unspected count, want: 2, got: %v", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("unspected result, want a panic registering another type")
+		}
+	}()
+	reg.Gauge("calls_total", "Calls.", "upstream")
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("up", "Whether the server is up.").With().Inc()
+
+	rr := httptest.NewRecorder()
+	reg.Handler()(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unspected content type, got: %s", ct)
+	}
+	if !strings.Contains(rr.Body.String(), "\nup 1\n") {
+		t.Errorf("unspected body, got: %s", rr.Body.String())
+	}
+}
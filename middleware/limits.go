@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// MaxBodyBytes limits request bodies to n bytes. Handlers reading more get
+// an *http.MaxBytesError.
+func MaxBodyBytes(n int64) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				problem.Write(w, r, &http.MaxBytesError{Limit: n})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			h(w, r)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/logging"
+)
+
+// Logger stores logger in the request context, with the request ID set by
+// RequestID, for handlers to log with logging.FromContext.
+func Logger(logger *slog.Logger) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := logging.NewContext(r.Context(), logger.With("request_id", RequestIDFrom(r.Context())))
+			h(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// LogRoute adds the route, and the user the request is about when userID
+// finds one, to the logger of the request. userID may be nil.
+func LogRoute(route string, userID func(*http.Request) string) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			logging.With(r.Context(), "route", route)
+			if userID != nil {
+				if id := userID(r); id != "" {
+					logging.With(r.Context(), "user_id", id)
+				}
+			}
+			h(w, r)
+		}
+	}
+}
+
+// AccessLog logs one line per request with the logger of the request, so
+// it has the fields added while serving it. Server errors are logged as
+// errors.
+func AccessLog() Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			defer func() {
+				status, level := rec.status, slog.LevelInfo
+				switch {
+				case status == 0:
+					status = http.StatusOK
+				case status >= http.StatusInternalServerError:
+					level = slog.LevelError
+				}
+				logging.FromContext(r.Context()).LogAttrs(r.Context(), level, "request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Int("status", status),
+					slog.Int("bytes", rec.bytes),
+					slog.Duration("duration", time.Since(start)),
+					slog.String("remote", r.RemoteAddr),
+				)
+			}()
+			h(rec, r)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/metrics"
+)
+
+// RouteMetrics records the requests of each route: how many were served
+// by method and status code, how long they took and how many are being
+// served.
+type RouteMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	inFlight *metrics.GaugeVec
+}
+
+// NewRouteMetrics registers the request metrics in reg.
+func NewRouteMetrics(reg *metrics.Registry) *RouteMetrics {
+	return &RouteMetrics{
+		requests: reg.Counter("http_requests_total", "Requests served, by route, method and status code.", "route", "method", "code"),
+		duration: reg.Histogram("http_request_duration_seconds", "Time spent serving requests, by route and method.", metrics.DefaultBuckets, "route", "method"),
+		inFlight: reg.Gauge("http_requests_in_flight", "Requests being served, by route.", "route"),
+	}
+}
+
+// Route records the requests served by h as route. Routes are named by the
+// caller rather than taken from the path, so user IDs don't end up as
+// label values.
+func (m *RouteMetrics) Route(route string) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		inFlight := m.inFlight.With(route)
+		return func(w http.ResponseWriter, r *http.Request) {
+			inFlight.Inc()
+			defer inFlight.Dec()
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			defer func() {
+				status := rec.status
+				p := recover()
+				switch {
+				case p != nil:
+					// Recover answers 500 further out.
+					status = http.StatusInternalServerError
+				case status == 0:
+					status = http.StatusOK
+				}
+				m.requests.With(route, r.Method, strconv.Itoa(status)).Inc()
+				m.duration.With(route, r.Method).Observe(time.Since(start).Seconds())
+				if p != nil {
+					panic(p)
+				}
+			}()
+			h(rec, r)
+		}
+	}
+}
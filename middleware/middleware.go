@@ -0,0 +1,71 @@
+// Package middleware holds composable decorators for http.HandlerFunc, in
+// the style of onlyAuthenticated, and a Chain builder to combine them.
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// Middleware decorates a handler with extra behavior.
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Chain combines mws into a single middleware. The first one is the
+// outermost, so Chain(a, b)(h) behaves like a(b(h)).
+func Chain(mws ...Middleware) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}
+}
+
+// Handler adapts mw to wrap any http.Handler, such as a ServeMux.
+func (mw Middleware) Handler(h http.Handler) http.Handler {
+	return mw(h.ServeHTTP)
+}
+
+// statusRecorder remembers the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, as WebSocket upgrades do.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController access to the original writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/logging"
+	"github.com/jegutierrez/functional_patterns_go/metrics"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+func serve(h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	h(res, req)
+	return res
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, strings.Repeat("ok", 100))
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	named := func(name string) Middleware {
+		return func(h http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				h(w, r)
+			}
+		}
+	}
+
+	serve(Chain(named("a"), named("b"), named("c"))(ok), httptest.NewRequest("GET", "/", nil))
+
+	if got := strings.Join(calls, ","); got != "a,b,c" {
+		t.Errorf("unspected order, want: a,b,c, got: %s", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID()(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	res := serve(h, req)
+	if seen != "abc" || res.Header().Get(RequestIDHeader) != "abc" {
+		t.Errorf("unspected request ID, want: abc, got: %s", seen)
+	}
+
+	serve(h, httptest.NewRequest("GET", "/", nil))
+	if len(seen) != 16 {
+		t.Errorf("unspected generated request ID, got: %q", seen)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var out strings.Builder
+	logger, _ := logging.New(&out, "json", "")
+	userID := func(r *http.Request) string { return strings.TrimPrefix(r.URL.Path, "/users/") }
+	h := Chain(RequestID(), Logger(logger), AccessLog(), LogRoute("users", userID))(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("found user")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest("GET", "/users/2", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	serve(h, req)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unspected lines, want: 2, got: %q", out.String())
+	}
+	for _, line := range lines {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatal(err)
+		}
+		if fields["request_id"] != "abc" || fields["route"] != "users" || fields["user_id"] != "2" {
+			t.Errorf("unspected fields, want: request_id, route and user_id, got: %s", line)
+		}
+	}
+	want := `"method":"GET","path":"/users/2","status":418`
+	if !strings.Contains(lines[1], want) {
+		t.Errorf("unspected access log, want: %s, got: %s", want, lines[1])
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var out strings.Builder
+	logger, _ := logging.New(&out, "text", "")
+	h := Chain(Logger(logger), Recover())(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	res := serve(h, httptest.NewRequest("GET", "/", nil))
+
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("unspected status, want: 500, got: %d", res.Code)
+	}
+	if !strings.Contains(out.String(), "level=ERROR msg=\"panic serving request\"") || !strings.Contains(out.String(), "panic=boom") {
+		t.Errorf("unspected log, got: %s", out.String())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tt := []struct {
+		name        string
+		handler     http.HandlerFunc
+		status      int
+		contentType string
+	}{
+		{name: "slow", handler: func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			w.Write([]byte("late"))
+		}, status: http.StatusServiceUnavailable, contentType: problem.ContentType},
+		{name: "fast", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("ok"))
+		}, status: http.StatusAccepted, contentType: "text/plain"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serve(Timeout(10*time.Millisecond)(tc.handler), httptest.NewRequest("GET", "/", nil))
+
+			if res.Code != tc.status || res.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("unspected response, want: %d %s, got: %d %s", tc.status, tc.contentType, res.Code, res.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	h := CORS(CORSOptions{AllowedOrigins: []string{"https://app.example"}, AllowedHeaders: []string{"Authorization"}})(ok)
+
+	tt := []struct {
+		name   string
+		origin string
+		method string
+		status int
+		allow  string
+	}{
+		{name: "allowed preflight", origin: "https://app.example", method: http.MethodOptions, status: http.StatusNoContent, allow: "https://app.example"},
+		{name: "allowed request", origin: "https://app.example", method: http.MethodGet, status: http.StatusOK, allow: "https://app.example"},
+		{name: "other origin", origin: "https://evil.example", method: http.MethodGet, status: http.StatusOK},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/", nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			res := serve(h, req)
+
+			if res.Code != tc.status || res.Header().Get("Access-Control-Allow-Origin") != tc.allow {
+				t.Errorf("unspected response, want: %d %q, got: %d %q", tc.status, tc.allow, res.Code, res.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestGzip(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := serve(Gzip()(ok), req)
+
+	if res.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("response was not compressed")
+	}
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if string(body) != strings.Repeat("ok", 100) {
+		t.Errorf("unspected body, got: %s", body)
+	}
+
+	notModified := Gzip()(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	if res := serve(notModified, req); res.Header().Get("Content-Encoding") != "" || res.Body.Len() != 0 {
+		t.Errorf("bodiless response must not be compressed")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := RateLimit(1, 2)(ok)
+
+	var statuses []int
+	for i := 0; i < 3; i++ {
+		statuses = append(statuses, serve(h, httptest.NewRequest("GET", "/", nil)).Code)
+	}
+
+	if statuses[0] != 200 || statuses[1] != 200 || statuses[2] != http.StatusTooManyRequests {
+		t.Errorf("unspected statuses, want: [200 200 429], got: %v", statuses)
+	}
+}
+
+func TestRouteMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := NewRouteMetrics(reg)
+	var inFlight float64
+	h := m.Route("users")(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = reg.Gauge("http_requests_in_flight", "").With("users").Value()
+		if r.URL.Query().Get("fail") != "" {
+			http.Error(w, "boom", http.StatusBadGateway)
+		}
+	})
+
+	serve(h, httptest.NewRequest("GET", "/users/1", nil))
+	serve(h, httptest.NewRequest("GET", "/users/2", nil))
+	serve(h, httptest.NewRequest("GET", "/users/3?fail=1", nil))
+
+	var out strings.Builder
+	reg.WriteText(&out)
+	for _, want := range []string{
+		`http_requests_total{route="users",method="GET",code="200"} 2`,
+		`http_requests_total{route="users",method="GET",code="502"} 1`,
+		`http_request_duration_seconds_count{route="users",method="GET"} 3`,
+		`http_requests_in_flight{route="users"} 0`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("unspected metrics, want line: %s, got:\n%s", want, out.String())
+		}
+	}
+	if inFlight != 1 {
+		t.Errorf("unspected in flight while serving, want: 1, got: %v", inFlight)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.New("server", exporter)
+	h := Chain(RequestID(), Trace(tracer, "balance"))(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracer.Start(r.Context(), "lookup")
+		span.End()
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest("GET", "/balance/2", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(RequestIDHeader, "abc")
+	serve(h, req)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("unspected spans, want: 2, got: %d", len(spans))
+	}
+	lookup, server := spans[0], spans[1]
+	if server.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("unspected server span, want child of the caller, got: %+v", server.SpanContext)
+	}
+	if lookup.Parent != server.SpanContext.SpanID {
+		t.Errorf("unspected lookup parent, want: %s, got: %s", server.SpanContext.SpanID, lookup.Parent)
+	}
+	if server.Name != "GET balance" || server.Kind != tracing.KindServer || server.Attribute("http.response.status_code") != http.StatusBadGateway ||
+		server.Attribute("http.request.id") != "abc" || server.Error == "" {
+		t.Errorf("unspected server span, got: %+v", server)
+	}
+}
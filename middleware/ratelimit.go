@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// Limit lets Rate requests per second through, with bursts of up to Burst.
+// Rate must be positive.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// RateLimitResult is the state of a bucket after taking a token from it.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token, when not allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// RateLimitStore keeps the token buckets. MemoryStore is the default, other
+// implementations may share buckets between servers.
+type RateLimitStore interface {
+	Take(key string, limit Limit, now time.Time) RateLimitResult
+}
+
+// KeyFunc identifies the client a request is accounted to.
+type KeyFunc func(r *http.Request) string
+
+// ClientIP accounts requests to the IP they come from.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// RateLimiter limits each client with a token bucket per route.
+type RateLimiter struct {
+	Store RateLimitStore
+	Key   KeyFunc
+}
+
+// NewRateLimiter keeps buckets in memory and accounts requests to key, or
+// to the client IP when key is nil.
+func NewRateLimiter(key KeyFunc) *RateLimiter {
+	if key == nil {
+		key = ClientIP
+	}
+	return &RateLimiter{Store: NewMemoryStore(), Key: key}
+}
+
+// Limit returns a middleware allowing each client limit requests on route.
+// Every response carries RateLimit-* headers and rejected ones get a 429
+// with Retry-After.
+func (l *RateLimiter) Limit(route string, limit Limit) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			result := l.Store.Take(route+"|"+l.Key(r), limit, time.Now())
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			if !result.Allowed {
+				retryAfter := ceilSeconds(result.RetryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				problem.Write(w, r, problem.New(http.StatusTooManyRequests, "rate limit exceeded, retry after %ds", retryAfter))
+				return
+			}
+			h(w, r)
+		}
+	}
+}
+
+// RateLimit allows each client IP rate requests per second with bursts of
+// up to burst requests, answering 429 to the rest.
+func RateLimit(rate float64, burst int) Middleware {
+	return NewRateLimiter(ClientIP).Limit("", Limit{Rate: rate, Burst: burst})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryStore keeps the buckets in a map. Buckets idle long enough to be
+// full again are dropped on the way.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweeps  int
+}
+
+// NewMemoryStore creates an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*tokenBucket{}}
+}
+
+// Take removes a token from the bucket of key.
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) RateLimitResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+	result := b.take(limit, now)
+
+	if s.sweeps++; s.sweeps >= 1000 {
+		s.sweeps = 0
+		for k, b := range s.buckets {
+			if b.full(now) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+	return result
+}
+
+// tokenBucket refills limit.Rate tokens per second up to limit.Burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+func (b *tokenBucket) refill(limit Limit, now time.Time) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+func (b *tokenBucket) take(limit Limit, now time.Time) RateLimitResult {
+	b.limit = limit
+	b.refill(limit, now)
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(b.tokens),
+		Reset:     secondsToDuration((float64(limit.Burst) - b.tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / limit.Rate)
+	}
+	return result
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
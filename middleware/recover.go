@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/jegutierrez/functional_patterns_go/logging"
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// Recover turns a panic in h into a 500 response, logging it with the
+// logger of the request. http.ErrAbortHandler is let through so handlers
+// can still abort on purpose.
+func Recover() Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				logging.FromContext(r.Context()).Error("panic serving request",
+					"method", r.Method, "path", r.URL.Path, "panic", err, "stack", string(debug.Stack()))
+				problem.Write(w, r, fmt.Errorf("panic: %v", err))
+			}()
+			h(w, r)
+		}
+	}
+}
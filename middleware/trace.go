@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+// Trace records a server span for every request served by h as route,
+// continuing the trace of the caller when the request has a traceparent.
+// Handlers find the span in the request context to start its children.
+func Trace(tracer tracing.Tracer, route string) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Extract(r.Context(), r.Header)
+			ctx, span := tracer.Start(ctx, r.Method+" "+route,
+				tracing.WithKind(tracing.KindServer),
+				tracing.WithAttributes(
+					tracing.Attr("http.request.method", r.Method),
+					tracing.Attr("http.route", route),
+					tracing.Attr("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+			if id := RequestIDFrom(r.Context()); id != "" {
+				span.SetAttributes(tracing.Attr("http.request.id", id))
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			h(rec, r.WithContext(ctx))
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(tracing.Attr("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+			}
+		}
+	}
+}
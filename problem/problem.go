@@ -0,0 +1,135 @@
+// Package problem answers errors as RFC 7807 problem details, with the
+// status code their type maps to, so every handler fails the same way.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jegutierrez/functional_patterns_go/logging"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Details is the body of an error response, as in RFC 7807.
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// Error is an error answered with Status. Its message is shown to clients
+// as the detail of the problem.
+type Error struct {
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error answered with status, formatted as fmt.Errorf.
+func New(status int, format string, args ...any) error {
+	return &Error{Status: status, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap returns err answered with status, or nil.
+func Wrap(status int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Status: status, Err: err}
+}
+
+// BadRequest is an error answered with 400.
+func BadRequest(format string, args ...any) error {
+	return New(http.StatusBadRequest, format, args...)
+}
+
+// Unauthorized is an error answered with 401.
+func Unauthorized(format string, args ...any) error {
+	return New(http.StatusUnauthorized, format, args...)
+}
+
+// Forbidden is an error answered with 403.
+func Forbidden(format string, args ...any) error {
+	return New(http.StatusForbidden, format, args...)
+}
+
+// NotFound is an error answered with 404.
+func NotFound(format string, args ...any) error {
+	return New(http.StatusNotFound, format, args...)
+}
+
+// MethodNotAllowed is an error answered with 405, the Allow header must be
+// set by the caller.
+func MethodNotAllowed(method string) error {
+	return New(http.StatusMethodNotAllowed, "method %s not allowed", method)
+}
+
+// StatusOf returns the status code err is answered with: the one of an
+// *Error, 413 for bodies over http.MaxBytesReader, 504 for deadlines, or
+// 500 for any other error.
+func StatusOf(err error) int {
+	var e *Error
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &e):
+		return e.Status
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Write answers err as problem details. The messages of errors other than
+// *Error aren't shown, they may tell too much about the server.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusOf(err)
+	details := Details{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: r.URL.Path,
+	}
+	var e *Error
+	if errors.As(err, &e) || status < http.StatusInternalServerError {
+		details.Detail = err.Error()
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(details)
+}
+
+// HandlerFunc is a handler returning its error instead of answering it.
+// It must not write the response when it fails.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Handle adapts h to an http.HandlerFunc answering the errors of h with
+// Write. Server errors are logged with the logger of the request.
+func Handle(h HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := h(w, r)
+		if err == nil {
+			return
+		}
+		if status := StatusOf(err); status >= http.StatusInternalServerError {
+			logging.FromContext(r.Context()).Error("request failed", "status", status, "error", err)
+		}
+		Write(w, r, err)
+	}
+}
@@ -0,0 +1,80 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandle(t *testing.T) {
+	tt := []struct {
+		name string
+		err  error
+		want Details
+	}{
+		{
+			name: "typed error",
+			err:  BadRequest("user ID %q is not a number", "abc"),
+			want: Details{Type: "about:blank", Title: "Bad Request", Status: 400, Detail: `user ID "abc" is not a number`, Instance: "/balance/abc"},
+		},
+		{
+			name: "wrapped typed error",
+			err:  fmt.Errorf("looking up: %w", Forbidden("not yours")),
+			want: Details{Type: "about:blank", Title: "Forbidden", Status: 403, Detail: "looking up: not yours", Instance: "/balance/abc"},
+		},
+		{
+			name: "deadline",
+			err:  fmt.Errorf("balance: %w", context.DeadlineExceeded),
+			want: Details{Type: "about:blank", Title: "Gateway Timeout", Status: 504, Instance: "/balance/abc"},
+		},
+		{
+			name: "body too large",
+			err:  &http.MaxBytesError{Limit: 10},
+			want: Details{Type: "about:blank", Title: "Request Entity Too Large", Status: 413, Detail: "http: request body too large", Instance: "/balance/abc"},
+		},
+		{
+			name: "untyped errors are hidden",
+			err:  errors.New("dial tcp 10.0.0.7:3306: connection refused"),
+			want: Details{Type: "about:blank", Title: "Internal Server Error", Status: 500, Instance: "/balance/abc"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := Handle(func(w http.ResponseWriter, r *http.Request) error {
+				return tc.err
+			})
+			res := httptest.NewRecorder()
+			h(res, httptest.NewRequest("GET", "/balance/abc", nil))
+
+			if res.Code != tc.want.Status || res.Header().Get("Content-Type") != ContentType {
+				t.Errorf("unspected response, want: %d %s, got: %d %s", tc.want.Status, ContentType, res.Code, res.Header().Get("Content-Type"))
+			}
+			var got Details
+			if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("unspected result, want: %+v, got: %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleSuccess(t *testing.T) {
+	h := Handle(func(w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("ok"))
+		return nil
+	})
+	res := httptest.NewRecorder()
+	h(res, httptest.NewRequest("GET", "/", nil))
+
+	if res.Code != http.StatusOK || strings.TrimSpace(res.Body.String()) != "ok" {
+		t.Errorf("unspected response, want: 200 ok, got: %d %s", res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,145 @@
+// Package router routes requests by method and path on top of the Go 1.22
+// http.ServeMux patterns, adding typed wildcards such as {id:int} and
+// answering unknown paths and methods as problem details.
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+// errNoRoute is returned by the checks of types for values of the right
+// form that still can't name a resource, such as signed ints, so their
+// requests get a 404 as if no route matched.
+var errNoRoute = errors.New("no route")
+
+// types are the wildcard types, by name, with how their values are checked.
+var types = map[string]func(string) error{
+	"int": func(s string) error {
+		if _, err := strconv.Atoi(s); err != nil {
+			return err
+		}
+		if s[0] < '0' || s[0] > '9' {
+			// only unsigned digits name resources.
+			return errNoRoute
+		}
+		return nil
+	},
+}
+
+// typedWildcard matches a {name:type} wildcard of a pattern.
+var typedWildcard = regexp.MustCompile(`\{(\w+):(\w+)\}`)
+
+// Router is an http.Handler routing each method and pattern to a handler.
+type Router struct {
+	mux *http.ServeMux
+
+	mu sync.RWMutex
+	// methods holds the methods handled on each path pattern, for 405s.
+	methods map[string][]string
+}
+
+// New creates a router answering 404 to paths without routes.
+func New() *Router {
+	rt := &Router{mux: http.NewServeMux(), methods: map[string][]string{}}
+	rt.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.NotFound("no route for %s", r.URL.Path))
+	})
+	return rt
+}
+
+// Handle routes the requests of method, e.g. GET, on path to h. The path
+// is a ServeMux pattern whose wildcards may be typed, as in
+// /users/{id:int}: requests whose value isn't of the type get a 400, or a
+// 404 for signed ints, and never reach h. GET routes answer HEAD too, and requests of other
+// methods on a path with routes get a 405 with the Allow header.
+func (rt *Router) Handle(method, path string, h http.HandlerFunc) {
+	var params []param
+	for _, m := range typedWildcard.FindAllStringSubmatch(path, -1) {
+		check, ok := types[m[2]]
+		if !ok {
+			panic(fmt.Sprintf("router: unknown type %s of {%s} in %s", m[2], m[1], path))
+		}
+		params = append(params, param{name: m[1], typ: m[2], check: check})
+	}
+	path = typedWildcard.ReplaceAllString(path, "{$1}")
+
+	rt.mu.Lock()
+	if _, ok := rt.methods[path]; !ok {
+		rt.mux.HandleFunc(path, rt.methodNotAllowed(path))
+	}
+	rt.methods[path] = append(rt.methods[path], method)
+	rt.mu.Unlock()
+
+	if len(params) > 0 {
+		h = typed(params, h)
+	}
+	rt.mux.HandleFunc(method+" "+path, h)
+}
+
+// HandleFunc is Handle for a problem.HandlerFunc.
+func (rt *Router) HandleFunc(method, path string, h problem.HandlerFunc) {
+	rt.Handle(method, path, problem.Handle(h))
+}
+
+// ServeHTTP dispatches r to the handler of its route.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// methodNotAllowed answers the requests on path whose method has no route.
+func (rt *Router) methodNotAllowed(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rt.mu.RLock()
+		allowed := append([]string(nil), rt.methods[path]...)
+		rt.mu.RUnlock()
+		for _, m := range allowed {
+			if m == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		problem.Write(w, r, problem.MethodNotAllowed(r.Method))
+	}
+}
+
+// param is a typed wildcard of a pattern.
+type param struct {
+	name, typ string
+	check     func(string) error
+}
+
+// typed answers 400 to requests whose wildcards aren't of their type, and
+// 404 to those whose values are refused with errNoRoute.
+func typed(params []param, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range params {
+			value := r.PathValue(p.name)
+			switch err := p.check(value); {
+			case errors.Is(err, errNoRoute):
+				problem.Write(w, r, problem.NotFound("no route for %s", r.URL.Path))
+				return
+			case err != nil:
+				problem.Write(w, r, problem.BadRequest("%s %q is not an %s", p.name, value, p.typ))
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// Int returns the value of the {name:int} wildcard of r, or 0 when r wasn't
+// routed by such a pattern.
+func Int(r *http.Request, name string) int {
+	n, _ := strconv.Atoi(r.PathValue(name))
+	return n
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jegutierrez/functional_patterns_go/problem"
+)
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	rt.Handle(http.MethodGet, "/users/{id:int}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "user %d", Int(r, "id"))
+	})
+	rt.Handle(http.MethodDelete, "/users/{id:int}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	rt.HandleFunc(http.MethodPost, "/users", func(w http.ResponseWriter, r *http.Request) error {
+		return problem.BadRequest("no body")
+	})
+
+	tt := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		body   string
+		allow  string
+	}{
+		{name: "typed param", method: "GET", path: "/users/2", status: 200, body: "user 2"},
+		{name: "head of get", method: "HEAD", path: "/users/2", status: 200},
+		{name: "other method", method: "DELETE", path: "/users/2", status: 204},
+		{name: "not an int", method: "GET", path: "/users/abc", status: 400},
+		{name: "negative int", method: "GET", path: "/users/-2", status: 404},
+		{name: "signed int", method: "GET", path: "/users/+2", status: 404},
+		{name: "extra segment", method: "GET", path: "/users/2/extra", status: 404},
+		{name: "missing param", method: "GET", path: "/users/", status: 404},
+		{name: "method not allowed", method: "PUT", path: "/users/2", status: 405, allow: "DELETE, GET, HEAD"},
+		{name: "method not allowed without params", method: "GET", path: "/users", status: 405, allow: "POST"},
+		{name: "problem handler", method: "POST", path: "/users", status: 400},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			rt.ServeHTTP(res, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if res.Code != tc.status {
+				t.Errorf("unspected status, want: %d, got: %d", tc.status, res.Code)
+			}
+			if res.Header().Get("Allow") != tc.allow {
+				t.Errorf("unspected Allow, want: %q, got: %q", tc.allow, res.Header().Get("Allow"))
+			}
+			if tc.status >= 400 {
+				var details problem.Details
+				if err := json.NewDecoder(res.Body).Decode(&details); err != nil || details.Status != tc.status {
+					t.Errorf("unspected problem, want status %d, got: %+v %v", tc.status, details, err)
+				}
+			} else if tc.body != "" && res.Body.String() != tc.body {
+				t.Errorf("unspected body, want: %s, got: %s", tc.body, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnknownTypePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("unspected result, want panic for an unknown type")
+		}
+	}()
+	New().Handle(http.MethodGet, "/users/{id:uuid}", func(http.ResponseWriter, *http.Request) {})
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileExporter appends spans to a file as OTLP JSON, one export request
+// per line, as the file exporter of the OpenTelemetry collector does.
+type FileExporter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileExporter appends spans to the file at path, creating it if needed.
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Export writes spans as a line.
+func (e *FileExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(toOTLP(spans))
+}
+
+// Shutdown closes the file.
+func (e *FileExporter) Shutdown(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
+
+// ReadSpans reads the spans written by a FileExporter.
+func ReadSpans(r io.Reader) ([]SpanData, error) {
+	var spans []SpanData
+	dec := json.NewDecoder(r)
+	for {
+		var req otlpRequest
+		err := dec.Decode(&req)
+		if errors.Is(err, io.EOF) {
+			return spans, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		read, err := fromOTLP(req)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, read...)
+	}
+}
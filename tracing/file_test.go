@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := waterfallSpans()
+	for _, s := range spans {
+		if err := exporter.Export(context.Background(), []SpanData{s}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	read, err := ReadSpans(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(spans) {
+		t.Fatalf("unspected spans, want: %d, got: %d", len(spans), len(read))
+	}
+	for i, want := range spans {
+		got := read[i]
+		if got.Name != want.Name || got.SpanContext.TraceID != want.SpanContext.TraceID || got.SpanContext.SpanID != want.SpanContext.SpanID ||
+			got.Parent != want.Parent || !got.Start.Equal(want.Start) || !got.End.Equal(want.End) || got.Error != want.Error {
+			t.Errorf("unspected span %d, want: %+v, got: %+v", i, want, got)
+		}
+	}
+}
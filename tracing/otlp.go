@@ -0,0 +1,428 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scopeName names this package as the instrumentation scope of the spans.
+const scopeName = "github.com/jegutierrez/functional_patterns_go/tracing"
+
+// OTLP status codes.
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+// The OTLP/HTTP JSON encoding of an export request, limited to the fields
+// recorded by this package. IDs are hex and 64 bit integers are strings,
+// as the OTLP JSON mapping asks.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// toOTLP groups spans by service, the resource of OTLP.
+func toOTLP(spans []SpanData) otlpRequest {
+	var req otlpRequest
+	byService := map[string]int{}
+	for _, s := range spans {
+		i, ok := byService[s.Service]
+		if !ok {
+			i = len(req.ResourceSpans)
+			byService[s.Service] = i
+			rs := otlpResourceSpans{
+				Resource:   otlpResource{Attributes: otlpAttributes([]Attribute{Attr("service.name", s.Service)})},
+				ScopeSpans: []otlpScopeSpans{{}},
+			}
+			rs.ScopeSpans[0].Scope.Name = scopeName
+			req.ResourceSpans = append(req.ResourceSpans, rs)
+		}
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: unixNano(s.Start),
+			EndTimeUnixNano:   unixNano(s.End),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusUnset},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		for _, e := range s.Events {
+			span.Events = append(span.Events, otlpEvent{TimeUnixNano: unixNano(e.Time), Name: e.Name, Attributes: otlpAttributes(e.Attributes)})
+		}
+		scope := &req.ResourceSpans[i].ScopeSpans[0]
+		scope.Spans = append(scope.Spans, span)
+	}
+	return req
+}
+
+// fromOTLP reads back the spans of an export request.
+func fromOTLP(req otlpRequest) ([]SpanData, error) {
+	var spans []SpanData
+	for _, rs := range req.ResourceSpans {
+		service, _ := fromOTLPAttributes(rs.Resource.Attributes)["service.name"].(string)
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				data := SpanData{Service: service, Name: s.Name, Kind: s.Kind, SpanContext: SpanContext{Sampled: true}}
+				err := errors.Join(
+					decodeID(data.SpanContext.TraceID[:], s.TraceID),
+					decodeID(data.SpanContext.SpanID[:], s.SpanID),
+				)
+				if s.ParentSpanID != "" {
+					err = errors.Join(err, decodeID(data.Parent[:], s.ParentSpanID))
+				}
+				if err != nil {
+					return nil, fmt.Errorf("span %q: %w", s.Name, err)
+				}
+				if data.Start, err = fromUnixNano(s.StartTimeUnixNano); err != nil {
+					return nil, err
+				}
+				if data.End, err = fromUnixNano(s.EndTimeUnixNano); err != nil {
+					return nil, err
+				}
+				data.Attributes = attributesOf(s.Attributes)
+				if s.Status.Code == otlpStatusError {
+					data.Error = s.Status.Message
+				}
+				for _, e := range s.Events {
+					at, err := fromUnixNano(e.TimeUnixNano)
+					if err != nil {
+						return nil, err
+					}
+					data.Events = append(data.Events, Event{Name: e.Name, Time: at, Attributes: attributesOf(e.Attributes)})
+				}
+				spans = append(spans, data)
+			}
+		}
+	}
+	return spans, nil
+}
+
+func decodeID(dst []byte, src string) error {
+	if len(src) != 2*len(dst) {
+		return fmt.Errorf("malformed ID %q", src)
+	}
+	if _, err := hex.Decode(dst, []byte(src)); err != nil {
+		return fmt.Errorf("malformed ID %q", src)
+	}
+	return nil
+}
+
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpAnyValue
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case bool:
+			v.BoolValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
+
+func attributesOf(kvs []otlpKeyValue) []Attribute {
+	var attrs []Attribute
+	for _, kv := range kvs {
+		attrs = append(attrs, Attr(kv.Key, fromOTLPValue(kv.Value)))
+	}
+	return attrs
+}
+
+func fromOTLPAttributes(kvs []otlpKeyValue) map[string]any {
+	m := map[string]any{}
+	for _, kv := range kvs {
+		m[kv.Key] = fromOTLPValue(kv.Value)
+	}
+	return m
+}
+
+// fromOTLPValue reads integers back as int, the type recorded by the
+// instrumentation of this module.
+func fromOTLPValue(v otlpAnyValue) any {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		n, _ := strconv.Atoi(*v.IntValue)
+		return n
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	}
+	return nil
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func fromUnixNano(s string) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", s)
+	}
+	return time.Unix(0, n), nil
+}
+
+// OTLPOption configures an OTLPExporter.
+type OTLPOption func(*OTLPExporter)
+
+// WithHTTPClient sends the spans with hc.
+func WithHTTPClient(hc *http.Client) OTLPOption {
+	return func(e *OTLPExporter) {
+		e.client = hc
+	}
+}
+
+// WithBatchSize sends the spans as soon as n are waiting, 512 by default.
+func WithBatchSize(n int) OTLPOption {
+	return func(e *OTLPExporter) {
+		e.batchSize = n
+	}
+}
+
+// WithFlushInterval sends the waiting spans every d, 5 seconds by default.
+func WithFlushInterval(d time.Duration) OTLPOption {
+	return func(e *OTLPExporter) {
+		e.interval = d
+	}
+}
+
+// OTLPExporter sends spans in batches to an OTLP/HTTP collector, using the
+// JSON encoding.
+type OTLPExporter struct {
+	endpoint  string
+	client    *http.Client
+	batchSize int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	pending []SpanData
+	full    chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+	// stopped is closed once the last flush, whose error is err, is done.
+	stopped chan struct{}
+	err     error
+	dropped atomic.Int64
+}
+
+// NewOTLPExporter sends spans to endpoint, the traces URL of a collector
+// such as http://localhost:4318/v1/traces, until Shutdown.
+func NewOTLPExporter(endpoint string, opts ...OTLPOption) *OTLPExporter {
+	e := &OTLPExporter{
+		endpoint:  endpoint,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		batchSize: 512,
+		interval:  5 * time.Second,
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	go e.run()
+	return e
+}
+
+// Export queues spans to be sent with the next batch.
+func (e *OTLPExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	e.pending = append(e.pending, spans...)
+	full := len(e.pending) >= e.batchSize
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Dropped counts the spans the collector didn't take.
+func (e *OTLPExporter) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+// Shutdown sends the spans still waiting and stops the exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	select {
+	case <-e.stopped:
+		return e.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.flush(context.Background())
+		case <-e.full:
+			e.flush(context.Background())
+		case <-e.stop:
+			e.err = e.flush(context.Background())
+			close(e.stopped)
+			return
+		}
+	}
+}
+
+// flush sends the waiting spans in a single request.
+func (e *OTLPExporter) flush(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	err := e.send(ctx, spans)
+	if err != nil {
+		e.dropped.Add(int64(len(spans)))
+	}
+	return err
+}
+
+func (e *OTLPExporter) send(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(toOTLP(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %d to %d spans", resp.StatusCode, len(spans))
+	}
+	return nil
+}
+
+// NewCollector stands in for an OTLP/HTTP collector, taking JSON export
+// requests on POST and passing their spans to exporter.
+func NewCollector(exporter Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/json" {
+			http.Error(w, "only the JSON encoding is supported", http.StatusUnsupportedMediaType)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		spans, err := fromOTLP(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := exporter.Export(r.Context(), spans); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}
+}
@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporterToCollector(t *testing.T) {
+	received := NewInMemoryExporter()
+	collector := httptest.NewServer(NewCollector(received))
+	defer collector.Close()
+	exporter := NewOTLPExporter(collector.URL, WithFlushInterval(time.Hour))
+	tracer := New("server", exporter)
+
+	ctx, root := tracer.Start(context.Background(), "GET user-status", WithKind(KindServer), WithAttributes(Attr("http.route", "user-status")))
+	_, child := tracer.Start(ctx, "balance", WithAttributes(Attr("user_id", 2), Attr("cached", true), Attr("ratio", 0.5)))
+	child.AddEvent("fault injected", Attr("latency_ms", 350))
+	child.End()
+	root.RecordError(context.DeadlineExceeded)
+	root.End()
+	if spans := received.Spans(); len(spans) != 0 {
+		t.Fatalf("unspected spans sent before flushing, got: %d", len(spans))
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Errorf("unspected error shutting down twice, got: %v", err)
+	}
+
+	got := received.Spans()
+	if len(got) != 2 {
+		t.Fatalf("unspected spans, want: 2, got: %d", len(got))
+	}
+	gotChild, gotRoot := got[0], got[1]
+	if gotChild.Parent != gotRoot.SpanContext.SpanID || gotChild.SpanContext.TraceID != gotRoot.SpanContext.TraceID {
+		t.Errorf("unspected parent, got: %+v", gotChild)
+	}
+	wantAttrs := []Attribute{Attr("user_id", 2), Attr("cached", true), Attr("ratio", 0.5)}
+	if !reflect.DeepEqual(gotChild.Attributes, wantAttrs) || gotChild.Service != "server" {
+		t.Errorf("unspected attributes, want: %v, got: %v", wantAttrs, gotChild.Attributes)
+	}
+	if len(gotChild.Events) != 1 || gotChild.Events[0].Attributes[0] != Attr("latency_ms", 350) {
+		t.Errorf("unspected events, got: %+v", gotChild.Events)
+	}
+	if gotRoot.Kind != KindServer || gotRoot.Error != context.DeadlineExceeded.Error() || gotRoot.Duration() <= 0 {
+		t.Errorf("unspected root, got: %+v", gotRoot)
+	}
+}
+
+func TestOTLPExporterBatches(t *testing.T) {
+	requests := make(chan int, 10)
+	collector := httptest.NewServer(NewCollector(exporterFunc(func(spans []SpanData) { requests <- len(spans) })))
+	defer collector.Close()
+	exporter := NewOTLPExporter(collector.URL, WithBatchSize(3), WithFlushInterval(time.Hour))
+	tracer := New("client", exporter)
+
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(context.Background(), "call")
+		span.End()
+	}
+	select {
+	case n := <-requests:
+		if n != 3 {
+			t.Errorf("unspected batch, want: 3, got: %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("full batch wasn't sent")
+	}
+	exporter.Shutdown(context.Background())
+	if exporter.Dropped() != 0 {
+		t.Errorf("unspected dropped spans, got: %d", exporter.Dropped())
+	}
+}
+
+func TestOTLPExporterDrops(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+	exporter := NewOTLPExporter(collector.URL, WithFlushInterval(time.Hour))
+	_, span := New("client", exporter).Start(context.Background(), "call")
+	span.End()
+
+	if err := exporter.Shutdown(context.Background()); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("unspected error, want collector 503, got: %v", err)
+	}
+	if exporter.Dropped() != 1 {
+		t.Errorf("unspected dropped spans, want: 1, got: %d", exporter.Dropped())
+	}
+}
+
+func TestCollectorRejects(t *testing.T) {
+	tt := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"get", http.MethodGet, "application/json", "", http.StatusMethodNotAllowed},
+		{"protobuf", http.MethodPost, "application/x-protobuf", "", http.StatusUnsupportedMediaType},
+		{"malformed", http.MethodPost, "application/json", "{", http.StatusBadRequest},
+		{"bad ID", http.MethodPost, "application/json", `{"resourceSpans":[{"scopeSpans":[{"spans":[{"traceId":"zz","spanId":"00f067aa0ba902b7","startTimeUnixNano":"1","endTimeUnixNano":"2"}]}]}]}`, http.StatusBadRequest},
+		{"empty", http.MethodPost, "application/json", `{"resourceSpans":[]}`, http.StatusOK},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/v1/traces", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			rr := httptest.NewRecorder()
+			NewCollector(NewInMemoryExporter())(rr, req)
+
+			if rr.Code != tc.want {
+				t.Errorf("unspected status, want: %d, got: %d", tc.want, rr.Code)
+			}
+		})
+	}
+}
+
+// exporterFunc adapts a function to Exporter.
+type exporterFunc func(spans []SpanData)
+
+func (f exporterFunc) Export(_ context.Context, spans []SpanData) error {
+	f(spans)
+	return nil
+}
+
+func (f exporterFunc) Shutdown(context.Context) error {
+	return nil
+}
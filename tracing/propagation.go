@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader carries the span context between services, see
+// https://www.w3.org/TR/trace-context/.
+const TraceparentHeader = "Traceparent"
+
+// FormatTraceparent formats sc as a version 00 traceparent.
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent reads a traceparent. Versions after 00 are read as 00,
+// ignoring the fields they may add, as the spec asks.
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", s)
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("unsupported traceparent version in %q", s)
+	}
+	var sc SpanContext
+	var flags [1]byte
+	for _, field := range []struct {
+		dst []byte
+		src string
+	}{
+		{sc.TraceID[:], parts[1]},
+		{sc.SpanID[:], parts[2]},
+		{flags[:], parts[3]},
+	} {
+		// the spec only allows lowercase hex.
+		if field.src != strings.ToLower(field.src) {
+			return SpanContext{}, fmt.Errorf("malformed traceparent %q", s)
+		}
+		if _, err := hex.Decode(field.dst, []byte(field.src)); err != nil {
+			return SpanContext{}, fmt.Errorf("malformed traceparent %q", s)
+		}
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("traceparent %q has a zero trace or span ID", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Inject sets the traceparent of the span in ctx on h, if there is one.
+func Inject(ctx context.Context, h http.Header) {
+	if sc := SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		h.Set(TraceparentHeader, FormatTraceparent(sc))
+	}
+}
+
+// Extract returns ctx with the span context of the traceparent in h, so the
+// spans started from it continue the trace of the caller. Invalid
+// traceparents are ignored and start a new trace.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
@@ -0,0 +1,314 @@
+// Package tracing records spans of work, their attributes, events and
+// parent/child relationships, propagates them between services with the
+// W3C traceparent header and exports them in memory or over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, shared by all its spans.
+type TraceID [16]byte
+
+// IsValid reports whether id isn't all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within its trace.
+type SpanID [8]byte
+
+// IsValid reports whether id isn't all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is what a span passes on to its children, in this process or
+// in another one.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// Remote is set when the span context was extracted from a request.
+	Remote bool
+}
+
+// IsValid reports whether sc identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind tells the role of a span in a call between services, numbered
+// as in OTLP.
+type SpanKind int
+
+// Span kinds.
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attribute describes a span or an event. Values are strings, bools,
+// integers or floats.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr creates an attribute.
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Event is something that happened at a point in time during a span.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// SpanData is a finished span, as exporters get it.
+type SpanData struct {
+	Service     string
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      SpanID
+	Start       time.Time
+	End         time.Time
+	Attributes  []Attribute
+	Events      []Event
+	// Error is the message of the error recorded on the span, if any.
+	Error string
+}
+
+// Duration is how long the span lasted.
+func (s SpanData) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Attribute returns the value of the attribute key, or nil.
+func (s SpanData) Attribute(key string) any {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// Span is a unit of work being traced.
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	// RecordError marks the span as failed, ignoring nil errors.
+	RecordError(err error)
+	// End finishes the span, calls after the first one do nothing.
+	End()
+}
+
+// Tracer starts spans. The span is a child of the span in ctx, local or
+// extracted from a request, and is returned in a context for its children.
+type Tracer interface {
+	Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span)
+}
+
+// SpanOption configures a span when it starts.
+type SpanOption func(*spanConfig)
+
+type spanConfig struct {
+	kind  SpanKind
+	attrs []Attribute
+}
+
+// WithKind sets the kind of the span, internal by default.
+func WithKind(kind SpanKind) SpanOption {
+	return func(c *spanConfig) {
+		c.kind = kind
+	}
+}
+
+// WithAttributes sets attributes when the span starts.
+func WithAttributes(attrs ...Attribute) SpanOption {
+	return func(c *spanConfig) {
+		c.attrs = append(c.attrs, attrs...)
+	}
+}
+
+// Exporter sends finished spans somewhere.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	// Shutdown flushes the spans still buffered.
+	Shutdown(ctx context.Context) error
+}
+
+// Provider is the Tracer recording spans to an exporter.
+type Provider struct {
+	service  string
+	exporter Exporter
+}
+
+// New records the spans of service to exporter.
+func New(service string, exporter Exporter) *Provider {
+	return &Provider{service: service, exporter: exporter}
+}
+
+// Start starts a span, see Tracer.
+func (p *Provider) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span) {
+	cfg := spanConfig{kind: KindInternal}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	parent := SpanFromContext(ctx).SpanContext()
+	sc := SpanContext{SpanID: newSpanID(), Sampled: true}
+	if parent.IsValid() {
+		sc.TraceID, sc.Sampled = parent.TraceID, parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+	}
+	s := &span{
+		provider: p,
+		data: SpanData{
+			Service:     p.service,
+			Name:        name,
+			Kind:        cfg.kind,
+			SpanContext: sc,
+			Parent:      parent.SpanID,
+			Start:       time.Now(),
+			Attributes:  cfg.attrs,
+		},
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+// Shutdown flushes the exporter, as a close hook of the lifecycle.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return p.exporter.Shutdown(ctx)
+}
+
+// span records its data until it ends, then hands it to the exporter.
+type span struct {
+	provider *Provider
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Attributes = append(s.data.Attributes, attrs...)
+	}
+}
+
+func (s *span) AddEvent(name string, attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+	}
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Error = err.Error()
+		s.data.Events = append(s.data.Events, Event{Name: "exception", Time: time.Now(), Attributes: []Attribute{Attr("exception.message", err.Error())}})
+	}
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.Sampled {
+		s.provider.exporter.Export(context.Background(), []SpanData{data})
+	}
+}
+
+// noopSpan records nothing, but carries a span context so it is still
+// propagated.
+type noopSpan struct{ sc SpanContext }
+
+func (s noopSpan) SpanContext() SpanContext    { return s.sc }
+func (noopSpan) SetAttributes(...Attribute)    {}
+func (noopSpan) AddEvent(string, ...Attribute) {}
+func (noopSpan) RecordError(error)             {}
+func (noopSpan) End()                          {}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...SpanOption) (context.Context, Span) {
+	// a span of its own, so ending it leaves the parent alone.
+	s := noopSpan{sc: SpanFromContext(ctx).SpanContext()}
+	return ContextWithSpan(ctx, s), s
+}
+
+// Noop returns a tracer recording nothing, which still passes on the trace
+// context it got.
+func Noop() Tracer {
+	return noopTracer{}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s.
+func ContextWithSpan(ctx context.Context, s Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span in ctx, or a span recording nothing.
+func SpanFromContext(ctx context.Context) Span {
+	if s, ok := ctx.Value(spanKey{}).(Span); ok {
+		return s
+	}
+	return noopSpan{}
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx whose spans are
+// children of sc, a span of another process.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return ContextWithSpan(ctx, noopSpan{sc: sc})
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
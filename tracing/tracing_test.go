@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParentChild(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := New("test", exporter)
+
+	ctx, root := tracer.Start(context.Background(), "root", WithAttributes(Attr("user_id", 2)))
+	_, child := tracer.Start(ctx, "child", WithKind(KindClient))
+	child.AddEvent("retry", Attr("attempt", 2))
+	child.RecordError(errors.New("boom"))
+	child.RecordError(nil)
+	child.End()
+	root.SetAttributes(Attr("cached", false))
+	root.End()
+	root.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("unspected spans, want: 2, got: %d", len(spans))
+	}
+	gotChild, gotRoot := spans[0], spans[1]
+	if gotChild.SpanContext.TraceID != gotRoot.SpanContext.TraceID || gotChild.Parent != gotRoot.SpanContext.SpanID {
+		t.Errorf("unspected parent, want child of %s, got: trace %s parent %s", gotRoot.SpanContext.SpanID, gotChild.SpanContext.TraceID, gotChild.Parent)
+	}
+	if gotRoot.Parent.IsValid() {
+		t.Errorf("unspected parent of root, got: %s", gotRoot.Parent)
+	}
+	if gotChild.Kind != KindClient || gotChild.Error != "boom" || len(gotChild.Events) != 2 || gotChild.Events[0].Name != "retry" {
+		t.Errorf("unspected child, got: %+v", gotChild)
+	}
+	if gotRoot.Attribute("user_id") != 2 || gotRoot.Attribute("cached") != false || gotRoot.Service != "test" {
+		t.Errorf("unspected root, got: %+v", gotRoot)
+	}
+	if gotRoot.Duration() < gotChild.Duration() {
+		t.Errorf("unspected durations, root %s is shorter than child %s", gotRoot.Duration(), gotChild.Duration())
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tt := []struct {
+		name    string
+		header  string
+		want    string
+		sampled bool
+		wantErr bool
+	}{
+		{name: "sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: "4bf92f3577b34da6a3ce929d0e0e4736/00f067aa0ba902b7", sampled: true},
+		{name: "not sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", want: "4bf92f3577b34da6a3ce929d0e0e4736/00f067aa0ba902b7"},
+		{name: "future version", header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", want: "4bf92f3577b34da6a3ce929d0e0e4736/00f067aa0ba902b7", sampled: true},
+		{name: "version ff", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "extra fields in 00", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{name: "zero trace ID", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero span ID", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{name: "uppercase", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "short", header: "00-4bf92f35-00f067aa0ba902b7-01", wantErr: true},
+		{name: "empty", header: "", wantErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.header)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unspected error, want error: %v, got: %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := sc.TraceID.String() + "/" + sc.SpanID.String(); got != tc.want || sc.Sampled != tc.sampled {
+				t.Errorf("unspected span context, want: %s sampled %v, got: %s sampled %v", tc.want, tc.sampled, got, sc.Sampled)
+			}
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	client, server := New("client", exporter), New("server", exporter)
+
+	ctx, call := client.Start(context.Background(), "GET balance", WithKind(KindClient))
+	h := http.Header{}
+	Inject(ctx, h)
+	call.End()
+
+	_, handled := server.Start(Extract(context.Background(), h), "balance", WithKind(KindServer))
+	handled.End()
+
+	spans := exporter.Spans()
+	if spans[1].SpanContext.TraceID != spans[0].SpanContext.TraceID || spans[1].Parent != spans[0].SpanContext.SpanID {
+		t.Errorf("unspected server span, want child of %s, got: %+v", spans[0].SpanContext.SpanID, spans[1].SpanContext)
+	}
+	if got := h.Get(TraceparentHeader); got != FormatTraceparent(spans[0].SpanContext) {
+		t.Errorf("unspected traceparent, got: %s", got)
+	}
+}
+
+func TestNoopPassesContextOn(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, span := Noop().Start(Extract(context.Background(), h), "ignored")
+	span.End()
+	out := http.Header{}
+	Inject(ctx, out)
+
+	if got := out.Get(TraceparentHeader); got != h.Get(TraceparentHeader) {
+		t.Errorf("unspected traceparent, want: %s, got: %s", h.Get(TraceparentHeader), got)
+	}
+
+	empty := http.Header{}
+	Inject(context.Background(), empty)
+	if len(empty) != 0 {
+		t.Errorf("unspected traceparent without a span, got: %v", empty)
+	}
+}
+
+func TestNotSampledIsNotExported(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+	_, span := New("server", exporter).Start(Extract(context.Background(), h), "balance")
+	span.End()
+
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Errorf("unspected spans, want none, got: %d", len(spans))
+	}
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteWaterfall draws the traces of spans, each span as a bar placed on
+// the timeline of its trace, under its parent:
+//
+//	trace 4bf92f3577b34da6a3ce929d0e0e4736 (352.4ms)
+//	GetUserStatus [client]         |██████████████████████████████| 352.4ms
+//	  GET users [client]           |█████████████                 | 152.1ms
+//	  GET balance [client]         |██████████████████████████████| 351.9ms
+//
+// Bars are width characters wide at most, spans that failed end with "!".
+func WriteWaterfall(w io.Writer, spans []SpanData, width int) error {
+	traces := map[TraceID][]SpanData{}
+	var order []TraceID
+	for _, s := range spans {
+		id := s.SpanContext.TraceID
+		if _, ok := traces[id]; !ok {
+			order = append(order, id)
+		}
+		traces[id] = append(traces[id], s)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return earliest(traces[order[i]]).Before(earliest(traces[order[j]]))
+	})
+
+	for i, id := range order {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if err := writeTrace(w, id, traces[id], width); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waterfallLine is a span with its depth in the trace tree.
+type waterfallLine struct {
+	span  SpanData
+	label string
+}
+
+func writeTrace(w io.Writer, id TraceID, spans []SpanData, width int) error {
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	start, end := earliest(spans), spans[0].End
+	known := map[SpanID]bool{}
+	children := map[SpanID][]SpanData{}
+	for _, s := range spans {
+		known[s.SpanContext.SpanID] = true
+		if s.End.After(end) {
+			end = s.End
+		}
+	}
+	var roots []SpanData
+	for _, s := range spans {
+		if known[s.Parent] {
+			children[s.Parent] = append(children[s.Parent], s)
+		} else {
+			// parents in another process, or not exported, are left out.
+			roots = append(roots, s)
+		}
+	}
+
+	var lines []waterfallLine
+	var walk func(s SpanData, depth int)
+	walk = func(s SpanData, depth int) {
+		label := strings.Repeat("  ", depth) + s.Name
+		if s.Service != "" {
+			label += " [" + s.Service + "]"
+		}
+		lines = append(lines, waterfallLine{span: s, label: label})
+		for _, child := range children[s.SpanContext.SpanID] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+
+	labelWidth := 0
+	for _, l := range lines {
+		labelWidth = max(labelWidth, len(l.label))
+	}
+	total := end.Sub(start)
+	if _, err := fmt.Fprintf(w, "trace %s (%s)\n", id, formatMillis(total)); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		offset, length := 0, width
+		if total > 0 {
+			offset = int(float64(l.span.Start.Sub(start)) / float64(total) * float64(width))
+			length = int(float64(l.span.Duration()) / float64(total) * float64(width))
+		}
+		offset = min(offset, width-1)
+		length = min(max(length, 1), width-offset)
+		bar := strings.Repeat(" ", offset) + strings.Repeat("█", length) + strings.Repeat(" ", width-offset-length)
+		failed := ""
+		if l.span.Error != "" {
+			failed = " !"
+		}
+		if _, err := fmt.Fprintf(w, "%-*s |%s| %s%s\n", labelWidth, l.label, bar, formatMillis(l.span.Duration()), failed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func earliest(spans []SpanData) time.Time {
+	start := spans[0].Start
+	for _, s := range spans[1:] {
+		if s.Start.Before(start) {
+			start = s.Start
+		}
+	}
+	return start
+}
+
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,52 @@
+// Command waterfall draws the traces in a file written by the file exporter
+// of the tracing package, or by an OpenTelemetry collector:
+//
+//	waterfall -file spans.jsonl [-trace 4bf92f3577b34da6a3ce929d0e0e4736] [-width 60]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jegutierrez/functional_patterns_go/tracing"
+)
+
+func main() {
+	file := flag.String("file", "spans.jsonl", "file of spans as OTLP JSON lines")
+	traceID := flag.String("trace", "", "only draw this trace")
+	width := flag.Int("width", 60, "width of the bars")
+	flag.Parse()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fatal("opening spans", err)
+	}
+	defer f.Close()
+	spans, err := tracing.ReadSpans(f)
+	if err != nil {
+		fatal("reading spans", err)
+	}
+	if *traceID != "" {
+		var selected []tracing.SpanData
+		for _, s := range spans {
+			if s.SpanContext.TraceID.String() == *traceID {
+				selected = append(selected, s)
+			}
+		}
+		spans = selected
+	}
+	if len(spans) == 0 {
+		fatal("drawing waterfall", fmt.Errorf("no spans to draw in %s", *file))
+	}
+	if err := tracing.WriteWaterfall(os.Stdout, spans, *width); err != nil {
+		fatal("drawing waterfall", err)
+	}
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
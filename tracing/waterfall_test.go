@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// waterfallSpans is a trace with a root and two children, the second one
+// failed, and a trace continued from another process.
+func waterfallSpans() []SpanData {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	trace := TraceID{1}
+	return []SpanData{
+		{Service: "svc", Name: "b", SpanContext: SpanContext{TraceID: trace, SpanID: SpanID{3}}, Parent: SpanID{1}, Start: at(50), End: at(100), Error: "boom"},
+		{Service: "svc", Name: "a", SpanContext: SpanContext{TraceID: trace, SpanID: SpanID{2}}, Parent: SpanID{1}, Start: at(0), End: at(40)},
+		{Service: "svc", Name: "root", SpanContext: SpanContext{TraceID: trace, SpanID: SpanID{1}}, Start: at(0), End: at(100)},
+		{Name: "remote", SpanContext: SpanContext{TraceID: TraceID{2}, SpanID: SpanID{4}}, Parent: SpanID{9}, Start: at(200), End: at(210)},
+	}
+}
+
+func TestWriteWaterfall(t *testing.T) {
+	var out strings.Builder
+	if err := WriteWaterfall(&out, waterfallSpans(), 10); err != nil {
+		t.Fatal(err)
+	}
+	want := "trace 01000000000000000000000000000000 (100.0ms)\n" +
+		"root [svc] |██████████| 100.0ms\n" +
+		"  a [svc]  |████      | 40.0ms\n" +
+		"  b [svc]  |     █████| 50.0ms !\n" +
+		"\n" +
+		"trace 02000000000000000000000000000000 (10.0ms)\n" +
+		"remote |██████████| 10.0ms\n"
+	if out.String() != want {
+		t.Errorf("unspected result, want:\n%s\ngot:\n%s", want, out.String())
+	}
+}